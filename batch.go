@@ -0,0 +1,482 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// BatchGetter is optionally implemented by a Getter that can load many
+// keys in one call, e.g. with a single SQL "IN" query. GetMulti uses it
+// for the misses this process owns.
+type BatchGetter interface {
+	// GetBatch loads keys[i] into dests[i] and returns one error per key.
+	GetBatch(ctx context.Context, keys []string, dests []Sink) []error
+}
+
+// BatchProtoGetter is optionally implemented by a ProtoGetter that can
+// fetch many keys of a group in one round trip. Batches do not negotiate
+// compression: values always travel uncompressed, even between peers
+// with CompressionOptions.Peers set.
+type BatchProtoGetter interface {
+	// GetBatch returns one result per key. The error is for the whole
+	// request; per-key failures are reported in BatchResult.Err.
+	GetBatch(ctx context.Context, group string, keys []string) ([]BatchResult, error)
+}
+
+// BatchResult is the outcome of one key of a batched peer request.
+type BatchResult struct {
+	Value []byte
+	// Expire is when the owner's value expires, or zero if it does not.
+	Expire time.Time
+	// Err is the key's error. A key the owner does not have reports an
+	// error that wraps ErrNotFound.
+	Err error
+}
+
+// maxBatchConcurrency bounds the Getter.Get and per-key peer calls one
+// GetMulti makes at the same time, so a large batch does not flood the
+// backend.
+const maxBatchConcurrency = 16
+
+// MultiError is returned by GetMulti when some keys failed.
+// It has one entry per key; nil entries succeeded.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	var msgs []string
+	for i, err := range m {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("key %d: %v", i, err))
+		}
+	}
+	return "groupcache: " + strings.Join(msgs, "; ")
+}
+
+// GetMulti is like Get for many keys at once. Cache hits are served
+// immediately; misses are grouped by owning peer and fetched with one
+// request per peer, and misses owned by this process are loaded through
+// BatchGetter if the Getter implements it. Otherwise, and for peers that
+// do not batch, at most maxBatchConcurrency keys are loaded at a time.
+//
+// dests[i] receives the value of keys[i]. If some keys fail the error
+// is a MultiError. Batched loads are not deduplicated with concurrent
+// Get calls for the same key.
+func (g *Group) GetMulti(ctx context.Context, keys []string, dests []Sink) (err error) {
+	g.peersOnce.Do(g.initPeers)
+	if len(keys) != len(dests) {
+		return errors.New("groupcache: GetMulti needs one dest Sink per key")
+	}
+	if g.closed.Load() {
+		return ErrGroupClosed
+	}
+	g.Stats.Gets.Add(int64(len(keys)))
+	ctx, span := g.startSpan(ctx, SpanGetMulti)
+	span.SetAttribute(AttrKeys, len(keys))
+	defer func() { span.End(err) }()
+
+	gen := g.Generation()
+	errs := make(MultiError, len(keys))
+	failed := false
+	fail := func(i int, err error) {
+		errs[i] = err
+		failed = true
+	}
+
+	// 先查本地缓存 按 key 的拥有者把未命中的分组
+	var local []int
+	remote := make(map[ProtoGetter][]int)
+	now := g.now()
+	// 和 Get 一样 每个需要加载的 key 都有 LoadStart 和 LoadFinish
+	finish := func(i int, peer string, err error) {
+		g.emit(Event{Type: EventLoadFinish, Key: keys[i], Peer: peer, Err: err, Duration: g.since(now)})
+	}
+	for i, key := range keys {
+		g.hot.hit(key, now)
+		if dests[i] == nil {
+			fail(i, errors.New("groupcache: nil dest Sink"))
+			continue
+		}
+		ck := cacheKey{key, gen}
+		if g.lookupNotFound(ck) {
+			g.Stats.NotFoundHits.Add(1)
+			fail(i, ErrNotFound)
+			continue
+		}
+		if value, which, ok := g.lookupCacheIn(ck); ok {
+			g.Stats.CacheHits.Add(1)
+			g.emit(Event{Type: EventCacheHit, Key: key, Cache: which})
+			g.maybeRefresh(ck, value)
+			if err := setSinkView(dests[i], value); err != nil {
+				fail(i, err)
+			}
+			continue
+		}
+
+		g.Stats.Loads.Add(1)
+		g.Stats.LoadsDeduped.Add(1)
+		g.emit(Event{Type: EventLoadStart, Key: key})
+		if peer, ok := g.peers.PickPeer(key); ok {
+			remote[peer] = append(remote[peer], i)
+		} else {
+			local = append(local, i)
+		}
+	}
+
+	start := g.inval.begin()
+	defer g.inval.end()
+
+	var mu sync.Mutex // guards local and errs from the peer goroutines
+	var wg sync.WaitGroup
+	for peer, idx := range remote {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results := g.getBatchFromPeer(ctx, peer, keys, idx, gen, start)
+			mu.Lock()
+			defer mu.Unlock()
+			for n, i := range idx {
+				r := results[n]
+				// 拥有者说不存在 不再本地加载
+				if errors.Is(r.Err, ErrNotFound) {
+					g.Stats.NotFoundLoads.Add(1)
+					fail(i, ErrNotFound)
+					finish(i, "", ErrNotFound)
+					continue
+				}
+				if r.Err != nil {
+					// 远程失败 退回到本地加载
+					g.Stats.PeerErrors.Add(1)
+					g.emit(Event{Type: EventPeerError, Key: keys[i], Peer: peerName(peer), Err: r.Err})
+					local = append(local, i)
+					continue
+				}
+				g.Stats.PeerLoads.Add(1)
+				finish(i, peerName(peer), nil)
+				if err := setSinkView(dests[i], ByteView{b: r.Value, e: r.Expire}); err != nil {
+					fail(i, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for n, err := range g.getBatchLocally(ctx, keys, dests, local, gen, start) {
+		finish(local[n], "", err)
+		if errors.Is(err, ErrNotFound) {
+			g.Stats.NotFoundLoads.Add(1)
+			fail(local[n], err)
+			continue
+		}
+		if err != nil {
+			g.Stats.LocalLoadErrs.Add(1)
+			fail(local[n], err)
+			continue
+		}
+		g.Stats.LocalLoads.Add(1)
+	}
+
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+// serveBatch answers a peer's batched request for keys.
+func (g *Group) serveBatch(ctx context.Context, keys []string) ([]BatchResult, error) {
+	g.Stats.ServerRequests.Add(1)
+	read, done := g.beginReplicaRead()
+	defer done()
+	views := make([]ByteView, len(keys))
+	dests := make([]Sink, len(keys))
+	for i := range keys {
+		dests[i] = ByteViewSink(&views[i])
+	}
+	err := g.GetMulti(ctx, keys, dests)
+	var errs MultiError
+	if err != nil && !errors.As(err, &errs) {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(keys))
+	for i := range keys {
+		results[i].Value = views[i].bytes()
+		results[i].Expire = views[i].e
+		if errs != nil {
+			results[i].Err = errs[i]
+		}
+		if errors.Is(results[i].Err, ErrNotFound) {
+			results[i].Err = &notFoundError{expire: g.notFoundExpire(keys[i])}
+		}
+		if results[i].Err == nil {
+			g.maybeReplicate(keys[i], read, views[i])
+		}
+	}
+	return results, nil
+}
+
+// getBatchFromPeer fetches keys[idx...] from peer, with one request if
+// the peer supports batching and one request per key otherwise.
+func (g *Group) getBatchFromPeer(ctx context.Context, peer ProtoGetter, keys []string, idx []int, gen, start uint64) []BatchResult {
+	results := make([]BatchResult, len(idx))
+
+	if bp, ok := peer.(BatchProtoGetter); ok {
+		batch := make([]string, len(idx))
+		for n, i := range idx {
+			batch[n] = keys[i]
+		}
+		ctx, span := g.startSpan(ctx, SpanPeerGetBatch)
+		span.SetAttribute(AttrPeer, peerName(peer))
+		span.SetAttribute(AttrKeys, len(batch))
+		ctx = g.injectTrace(ctx)
+		t := g.now()
+		res, err := bp.GetBatch(ctx, g.name, batch)
+		d := g.since(t)
+		g.Stats.PeerLoadLatency.Observe(d)
+		g.Stats.peerLatency.observe(peerName(peer), d)
+		if err == nil && len(res) != len(batch) {
+			err = fmt.Errorf("groupcache: peer returned %d results for %d keys", len(res), len(batch))
+		}
+		span.End(err)
+		for n := range results {
+			if err != nil {
+				results[n].Err = err
+				continue
+			}
+			results[n] = res[n]
+		}
+	} else {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, maxBatchConcurrency)
+		for n, i := range idx {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				value, err := g.getFromPeer(ctx, peer, keys[i])
+				if err == nil {
+					value, err = g.decompress(value)
+				}
+				results[n] = BatchResult{Value: value.ByteSlice(), Expire: value.e, Err: err}
+			}()
+		}
+		wg.Wait()
+	}
+
+	for n, i := range idx {
+		var nf *notFoundError
+		if errors.As(results[n].Err, &nf) && !nf.expire.IsZero() {
+			ck := cacheKey{keys[i], gen}
+			g.inval.populate(keys[i], start, func() {
+				g.populateCache(ck, ByteView{e: nf.expire}, &g.missCache)
+			})
+		}
+		if results[n].Err == nil {
+			value := g.withTTL(ByteView{b: results[n].Value, e: results[n].Expire})
+			results[n].Expire = value.e
+			g.maybePopulateHotCache(cacheKey{keys[i], gen}, start, value)
+		}
+	}
+	return results
+}
+
+// getBatchLocally loads keys[idx...] with the Getter and populates the
+// main cache. It returns one error per entry of idx.
+func (g *Group) getBatchLocally(ctx context.Context, keys []string, dests []Sink, idx []int, gen, start uint64) []error {
+	if len(idx) == 0 {
+		return nil
+	}
+	ctx, span := g.startSpan(ctx, SpanGetBatch)
+	span.SetAttribute(AttrKeys, len(idx))
+	defer span.End(nil)
+
+	batchKeys := make([]string, len(idx))
+	batchDests := make([]Sink, len(idx))
+	for n, i := range idx {
+		batchKeys[n] = keys[i]
+		batchDests[n] = dests[i]
+	}
+
+	var errs []error
+	if bg, ok := g.getter.(BatchGetter); ok {
+		errs = bg.GetBatch(ctx, batchKeys, batchDests)
+		if len(errs) != len(idx) {
+			err := fmt.Errorf("groupcache: GetBatch returned %d errors for %d keys", len(errs), len(idx))
+			errs = make([]error, len(idx))
+			for n := range errs {
+				errs[n] = err
+			}
+			return errs
+		}
+	} else {
+		errs = make([]error, len(idx))
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, maxBatchConcurrency)
+		for n := range idx {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				t := g.now()
+				errs[n] = g.getter.Get(ctx, batchKeys[n], batchDests[n])
+				g.Stats.LocalLoadLatency.Observe(g.since(t))
+			}()
+		}
+		wg.Wait()
+	}
+
+	for n, err := range errs {
+		if errors.Is(err, ErrNotFound) && g.notFoundTTL > 0 {
+			ck := cacheKey{batchKeys[n], gen}
+			expire := g.now().Add(g.notFoundTTL)
+			g.inval.populate(batchKeys[n], start, func() {
+				g.populateCache(ck, ByteView{e: expire}, &g.missCache)
+			})
+		}
+		if err != nil {
+			continue
+		}
+		value, err := batchDests[n].view()
+		if err != nil {
+			errs[n] = err
+			continue
+		}
+		value = g.withTTL(value)
+		setSinkExpire(batchDests[n], value.e)
+		g.populateSince(start, cacheKey{batchKeys[n], gen}, value, &g.mainCache)
+	}
+	return errs
+}
+
+// Wire format of a batched peer request, hand-encoded with protowire:
+//
+//	message GetBatchRequest {
+//	  string group = 1;
+//	  repeated string keys = 2;
+//	}
+//	message GetBatchResponse {
+//	  repeated Item items = 1;
+//	}
+//	message Item {
+//	  bytes value = 1;
+//	  string error = 2;
+//	  int64 expire = 3; // Unix nanoseconds, absent if the value does not expire
+//	  int64 not_found = 4; // like GetResponse.not_found, instead of error
+//	}
+
+func encodeBatchRequest(group string, keys []string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, group)
+	for _, key := range keys {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, key)
+	}
+	return b
+}
+
+func decodeBatchRequest(b []byte) (group string, keys []string, err error) {
+	err = walkFields(b, func(num protowire.Number, v []byte) {
+		switch num {
+		case 1:
+			group = string(v)
+		case 2:
+			keys = append(keys, string(v))
+		}
+	})
+	return
+}
+
+func encodeBatchResponse(results []BatchResult) []byte {
+	var b, item []byte
+	for _, r := range results {
+		item = item[:0]
+		item = protowire.AppendTag(item, 1, protowire.BytesType)
+		item = protowire.AppendBytes(item, r.Value)
+		if errors.Is(r.Err, ErrNotFound) {
+			var expire uint64
+			var nf *notFoundError
+			if errors.As(r.Err, &nf) && !nf.expire.IsZero() {
+				expire = uint64(nf.expire.UnixNano())
+			}
+			item = protowire.AppendTag(item, 4, protowire.VarintType)
+			item = protowire.AppendVarint(item, expire)
+		} else if r.Err != nil {
+			item = protowire.AppendTag(item, 2, protowire.BytesType)
+			item = protowire.AppendString(item, r.Err.Error())
+		}
+		if !r.Expire.IsZero() {
+			item = protowire.AppendTag(item, 3, protowire.VarintType)
+			item = protowire.AppendVarint(item, uint64(r.Expire.UnixNano()))
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, item)
+	}
+	return b
+}
+
+func decodeBatchResponse(b []byte) ([]BatchResult, error) {
+	var results []BatchResult
+	var itemErr error
+	err := walkFields(b, func(num protowire.Number, item []byte) {
+		if num != 1 {
+			return
+		}
+		var r BatchResult
+		itemErr = errors.Join(itemErr, walkFields(item, func(num protowire.Number, v []byte) {
+			switch num {
+			case 1:
+				r.Value = cloneBytes(v)
+			case 2:
+				r.Err = errors.New(string(v))
+			}
+		}))
+		if ns, ok := varintField(item, 3); ok {
+			r.Expire = time.Unix(0, int64(ns))
+		}
+		if ns, ok := varintField(item, 4); ok {
+			nf := &notFoundError{}
+			if ns != 0 {
+				nf.expire = time.Unix(0, int64(ns))
+			}
+			r.Err = nf
+		}
+		results = append(results, r)
+	})
+	if err == nil {
+		err = itemErr
+	}
+	return results, err
+}
+
+// walkFields calls fn for every length-delimited field of a message.
+func walkFields(b []byte, fn func(num protowire.Number, v []byte)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		fn(num, v)
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/gcache/singleflight"
+)
+
+type batchGetterFunc func(ctx context.Context, keys []string, dests []Sink) []error
+
+func (f batchGetterFunc) Get(ctx context.Context, key string, dest Sink) error {
+	return f(ctx, []string{key}, []Sink{dest})[0]
+}
+
+func (f batchGetterFunc) GetBatch(ctx context.Context, keys []string, dests []Sink) []error {
+	return f(ctx, keys, dests)
+}
+
+// keyPicker sends keys with the given prefix to peer
+type keyPicker struct {
+	prefix string
+	peer   ProtoGetter
+}
+
+func (p keyPicker) PickPeer(key string) (ProtoGetter, bool) {
+	if strings.HasPrefix(key, p.prefix) {
+		return p.peer, true
+	}
+	return nil, false
+}
+
+func newTestGroup(name string, getter Getter, peers PeerPicker) *Group {
+	return &Group{
+		name:       name,
+		getter:     getter,
+		peers:      peers,
+		cacheBytes: 1 << 20,
+		loadGroup:  &singleflight.Group{},
+	}
+}
+
+func getMultiStrings(g *Group, keys []string) ([]string, error) {
+	values := make([]string, len(keys))
+	dests := make([]Sink, len(keys))
+	for i := range keys {
+		dests[i] = StringSink(&values[i])
+	}
+	return values, g.GetMulti(context.TODO(), keys, dests)
+}
+
+func TestGetMultiLocal(t *testing.T) {
+	var batches [][]string
+	g := newTestGroup("get-multi-local", batchGetterFunc(func(_ context.Context, keys []string, dests []Sink) []error {
+		batches = append(batches, keys)
+		errs := make([]error, len(keys))
+		for i, key := range keys {
+			if key == "bad" {
+				errs[i] = errors.New("not found")
+				continue
+			}
+			dests[i].SetString("v:" + key)
+		}
+		return errs
+	}), NoPeers{})
+
+	var s string
+	if err := g.Get(context.TODO(), "a", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	batches = nil
+
+	values, err := getMultiStrings(g, []string{"a", "b", "bad", "c"})
+	var errs MultiError
+	if !errors.As(err, &errs) {
+		t.Fatalf("GetMulti error = %v; want MultiError", err)
+	}
+	if errs[0] != nil || errs[1] != nil || errs[2] == nil || errs[3] != nil {
+		t.Errorf("per-key errors = %v; want only key 2 to fail", errs)
+	}
+	if want := []string{"v:a", "v:b", "", "v:c"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %q; want %q", values, want)
+	}
+	// 命中缓存的 a 不会再加载 其余的 key 一次批量加载
+	if want := [][]string{{"b", "bad", "c"}}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("GetBatch calls = %q; want %q", batches, want)
+	}
+	if got := g.Stats.CacheHits.Get(); got != 1 {
+		t.Errorf("CacheHits = %d; want 1", got)
+	}
+	if got := g.Stats.LocalLoadErrs.Get(); got != 1 {
+		t.Errorf("LocalLoadErrs = %d; want 1", got)
+	}
+
+	// 加载成功的值进入了 mainCache
+	batches = nil
+	if _, err := getMultiStrings(g, []string{"b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if batches != nil {
+		t.Errorf("cached keys were loaded again: %q", batches)
+	}
+}
+
+func TestGetMultiPlainGetter(t *testing.T) {
+	g := newTestGroup("get-multi-plain", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v:" + key)
+	}), NoPeers{})
+
+	values, err := getMultiStrings(g, []string{"x", "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v:x", "v:y"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %q; want %q", values, want)
+	}
+	if err := g.GetMulti(context.TODO(), []string{"x"}, nil); err == nil {
+		t.Error("GetMulti with mismatched dests succeeded")
+	}
+}
+
+func TestGetMultiBoundsLocalLoads(t *testing.T) {
+	var inflight, peak atomic.Int32
+	g := newTestGroup("get-multi-bounded", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return dest.SetString(key)
+	}), NoPeers{})
+
+	keys := make([]string, 10*maxBatchConcurrency)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	if _, err := getMultiStrings(g, keys); err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > maxBatchConcurrency || p < 2 {
+		t.Errorf("%d concurrent loads; want between 2 and %d", p, maxBatchConcurrency)
+	}
+}
+
+func TestGetMultiPeerFanOut(t *testing.T) {
+	const name = "get-multi-peer"
+	reg := newTestRegistry(t)
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: reg}))
+	defer ts.Close()
+	testGetMultiPeerFanOut(t, reg, name, &httpGetter{baseURL: ts.URL + defaultBasePath})
+}
+
+func TestGetMultiGRPCPeerFanOut(t *testing.T) {
+	const name = "get-multi-grpc-peer"
+	reg := newTestRegistry(t)
+	lis := startBufconnServer(t, newGRPCPool("owner", &GRPCPoolOptions{Registry: reg}))
+	client := newGRPCPool("client", &GRPCPoolOptions{DialOptions: bufconnDialOptions(lis)})
+	defer client.Close()
+	client.Set("passthrough:///owner")
+	peer, _ := client.PickPeer("r-1")
+	if _, ok := peer.(BatchProtoGetter); !ok {
+		t.Fatal("gRPC getter does not batch")
+	}
+	testGetMultiPeerFanOut(t, reg, name, peer)
+}
+
+// testGetMultiPeerFanOut checks GetMulti against peer, which serves reg's
+// group name.
+func testGetMultiPeerFanOut(t *testing.T, reg *Registry, name string, peer ProtoGetter) {
+	t.Helper()
+	var ownerLoads atomic.Int32
+	owner := reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		ownerLoads.Add(1)
+		if key == "r-bad" {
+			return errors.New("owner failed")
+		}
+		return dest.SetString("owner:" + key)
+	}), NoPeers{})
+
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), keyPicker{prefix: "r-", peer: peer})
+
+	values, err := getMultiStrings(g, []string{"r-1", "l-1", "r-2", "r-bad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 远程失败的 key 退回本地加载
+	if want := []string{"owner:r-1", "local:l-1", "owner:r-2", "local:r-bad"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %q; want %q", values, want)
+	}
+	if got := owner.Stats.ServerRequests.Get(); got != 1 {
+		t.Errorf("owner ServerRequests = %d; want 1 batched request", got)
+	}
+	if got := ownerLoads.Load(); got != 3 {
+		t.Errorf("owner loads = %d; want 3", got)
+	}
+	if got := g.Stats.PeerLoads.Get(); got != 2 {
+		t.Errorf("PeerLoads = %d; want 2", got)
+	}
+	if got := g.Stats.PeerErrors.Get(); got != 1 {
+		t.Errorf("PeerErrors = %d; want 1", got)
+	}
+}
+
+func TestServeBatchGroupMismatch(t *testing.T) {
+	r := newTestRegistry(t)
+	r.NewGroup("a", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}), NoPeers{})
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: r}))
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+defaultBasePath+"a/", "application/x-protobuf", bytes.NewReader(encodeBatchRequest("b", []string{"k"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("batch for another group: status %d; want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestBatchWireFormat(t *testing.T) {
+	group, keys, err := decodeBatchRequest(encodeBatchRequest("g", []string{"a", "", "c"}))
+	if err != nil || group != "g" || !reflect.DeepEqual(keys, []string{"a", "", "c"}) {
+		t.Errorf("request round trip = %q, %q, %v", group, keys, err)
+	}
+
+	in := []BatchResult{{Value: []byte("x")}, {Err: errors.New("boom")}, {}}
+	out, err := decodeBatchResponse(encodeBatchResponse(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 || string(out[0].Value) != "x" || out[1].Err == nil || out[1].Err.Error() != "boom" || out[2].Err != nil {
+		t.Errorf("response round trip = %+v", out)
+	}
+
+	expire := time.Unix(0, 12345)
+	out, err = decodeBatchResponse(encodeBatchResponse([]BatchResult{{Value: []byte("y"), Expire: expire}, {Err: ErrNotFound}, {Err: &notFoundError{expire: expire}}}))
+	var nf *notFoundError
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case !out[0].Expire.Equal(expire):
+		t.Errorf("expire round trip = %v; want %v", out[0].Expire, expire)
+	case !errors.Is(out[1].Err, ErrNotFound):
+		t.Errorf("not found round trip = %v; want ErrNotFound", out[1].Err)
+	case !errors.As(out[2].Err, &nf) || !nf.expire.Equal(expire):
+		t.Errorf("not found expiry round trip = %v", out[2].Err)
+	}
+
+	if _, err := decodeBatchResponse([]byte{0x0a, 0x05}); err == nil {
+		t.Error("truncated response decoded without error")
+	}
+}
@@ -7,13 +7,36 @@ import (
 	"errors"
 	"io"
 	"strings"
+	"time"
 )
 
 type ByteView struct {
 	b []byte
 	s string
+	// 过期时间 零值表示永不过期
+	e time.Time
+	// b 是压缩过的 只出现在缓存里 见 WithCompression
+	z bool
 }
 
+// Expire returns the time the view expires, or the zero time if it never does.
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && !now.Before(v.e)
+}
+
+
+// bytes returns the data without copying it when it is held as bytes.
+// The result must not be modified.
+func (v ByteView) bytes() []byte {
+	if v.b != nil {
+		return v.b
+	}
+	return []byte(v.s)
+}
 
 // Return the length of the v
 func (v ByteView) Len() int {
@@ -23,6 +46,14 @@ func (v ByteView) Len() int {
 	return len(v.s)
 }
 
+// ByteSlice returns a copy of the data as a byte slice.
+func (v ByteView) ByteSlice() []byte {
+	if v.b != nil {
+		return cloneBytes(v.b)
+	}
+	return []byte(v.s)
+}
+
 // String changes v to String if v is []byte
 func (v ByteView) String() string {
 	if v.b != nil {
@@ -130,16 +161,16 @@ func (v ByteView) Equal(v2 ByteView) bool {
 // SliceFrom slice the view from the provided index to the end
 func (v ByteView) SliceFrom(from int) ByteView {
 	if v.b != nil {
-		return ByteView{b: v.b[from:]}
+		return ByteView{b: v.b[from:], e: v.e}
 	}
 
-	return ByteView{s: v.s[from:]}
+	return ByteView{s: v.s[from:], e: v.e}
 }
 
 func (v ByteView) Slice(from, to int) ByteView {
 	if v.b != nil {
-		return ByteView{b: v.b[from:to]}
+		return ByteView{b: v.b[from:to], e: v.e}
 	}
 
-	return ByteView{s: v.s[from:to]}
+	return ByteView{s: v.s[from:to], e: v.e}
 }
\ No newline at end of file
@@ -2,3 +2,17 @@ package cachepolicy
 
 type Key interface{}
 
+// Policy is a cache that decides which entry to evict. The caches of a
+// groupcache Group are policies without a limit of their own; the group
+// evicts with RemoveOldest until its byte budget is met. A Policy is
+// not safe for concurrent access.
+type Policy interface {
+	Add(key Key, value interface{})
+	Get(key Key) (value interface{}, ok bool)
+	Remove(key Key)
+	// RemoveOldest removes the entry the policy would evict next.
+	RemoveOldest()
+	Len() int
+}
+
+var _ Policy = (*LRUCache)(nil)
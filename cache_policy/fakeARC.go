@@ -1,10 +1,12 @@
 package cachepolicy
 
 import (
-	"container/list"
 	"sync"
 )
 
+// ListType is the list of an ARC an entry is in. The ghost lists RG
+// and FG remember the keys recently evicted from LRU and LFU. The
+// generic LRU cache is TypedLRU, so these names stay as they were.
 type ListType int
 
 const (
@@ -14,128 +16,186 @@ const (
 	FG
 )
 
-type ARCEntry struct {
-	key       Key
-	value     interface{}
+type arcEntry[K comparable, V any] struct {
+	prev, next *arcEntry[K, V]
+	key        K
+	value      V
 	// O(1) 快速定位
 	ListType ListType
 }
 
-type ARCCache struct {
+// arcList is a doubly linked list of entries linked through their own
+// fields, like the list of TypedLRU.
+type arcList[K comparable, V any] struct {
+	// root.next 是最新的 root.prev 是最旧的
+	root arcEntry[K, V]
+	len  int
+}
+
+func (l *arcList[K, V]) init() {
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	l.len = 0
+}
+
+func (l *arcList[K, V]) pushFront(e *arcEntry[K, V]) {
+	e.prev = &l.root
+	e.next = l.root.next
+	e.prev.next = e
+	e.next.prev = e
+	l.len++
+}
+
+func (l *arcList[K, V]) remove(e *arcEntry[K, V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+	l.len--
+}
+
+// back returns the oldest entry, or nil.
+func (l *arcList[K, V]) back() *arcEntry[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+// ARC is an adaptive replacement cache of values of type V under keys of
+// type K. It is safe for concurrent access.
+//
+// Keys seen once live in LRU, keys seen again in LFU. Evicted keys are
+// remembered, without their values, in the ghost lists RG and FG; a hit
+// there shifts the target size p of LRU towards the list that would have
+// kept the key. Entries are linked through their own fields, so an Add
+// of a new key makes one allocation.
+type ARC[K comparable, V any] struct {
 	mu sync.Mutex
 
-	// capacity is the max entries 
+	// capacity is the max entries
 	// lru + lfu == capacity
 	// zero mean no limit. But I'm not sure no limit will be a good approach
 	// So we will panic when you input 0
 	capacity int
 	// Adaptive parameters
 	// 也就是lru期望的大小
-	p        int
+	p int
 
 	// OnEvicted optionally specifies a callback function to be
-	// executed when an entry is purged from the cache.
-	OnEvcted func(key Key, value interface{})
+	// executed when an entry is purged from the cache. Keys dropped from
+	// the ghost lists hold no value and are not reported.
+	OnEvcted func(key K, value V)
 
-	lru       *list.List
-	lru_ghost *list.List
-	lfu       *list.List
-	lfu_ghost *list.List
+	lru       arcList[K, V]
+	lru_ghost arcList[K, V]
+	lfu       arcList[K, V]
+	lfu_ghost arcList[K, V]
 
-	cache map[interface{}]*list.Element
+	cache map[K]*arcEntry[K, V]
 }
 
-func ARCNew(capacity int) *ARCCache {
+// ARCCache is an ARC with interface{} keys and values.
+type ARCCache = ARC[Key, interface{}]
+
+// ARCEntry is an entry of an ARCCache.
+type ARCEntry = arcEntry[Key, interface{}]
+
+// NewARC returns an ARC holding capacity entries.
+func NewARC[K comparable, V any](capacity int) *ARC[K, V] {
 	if capacity <= 0 {
 		panic("capacity must be > 0")
 	}
 
-	return &ARCCache{
-		capacity:  capacity,
-		p:         0,
-		lru:       list.New(),
-		lru_ghost: list.New(),
-		lfu:       list.New(),
-		lfu_ghost: list.New(),
-		cache:     make(map[interface{}]*list.Element),
+	c := &ARC[K, V]{capacity: capacity}
+	c.init()
+	return c
+}
+
+func ARCNew(capacity int) *ARCCache {
+	return NewARC[Key, interface{}](capacity)
+}
+
+func (c *ARC[K, V]) init() {
+	c.cache = make(map[K]*arcEntry[K, V])
+	c.lru.init()
+	c.lru_ghost.init()
+	c.lfu.init()
+	c.lfu_ghost.init()
+}
+
+// list returns the list of type t.
+func (c *ARC[K, V]) list(t ListType) *arcList[K, V] {
+	switch t {
+	case LRU:
+		return &c.lru
+	case RG:
+		return &c.lru_ghost
+	case LFU:
+		return &c.lfu
 	}
+	return &c.lfu_ghost
+}
+
+// move moves e to the front of list t.
+func (c *ARC[K, V]) move(e *arcEntry[K, V], t ListType) {
+	c.list(e.ListType).remove(e)
+	e.ListType = t
+	c.list(t).pushFront(e)
 }
 
 // 将key value 放入ARC 中
 // 如果缓存中已经有了 那么就 update
-func (c *ARCCache) Add(key Key, value interface{}) {
+func (c *ARC[K, V]) Add(key K, value V) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.cache == nil {
-		c.cache = make(map[interface{}]*list.Element)
-		c.lru = list.New()
-		c.lru_ghost = list.New()
-		c.lfu = list.New()
-		c.lfu_ghost = list.New()
+		c.init()
 	}
 
-	if elem, ok := c.cache[key]; ok {
-		entry := elem.Value.(*ARCEntry)
-
+	if entry, ok := c.cache[key]; ok {
 		switch entry.ListType {
-		case LRU:
+		case LRU, LFU:
+			// 第二次访问 放到 lfu 的最前面
 			entry.value = value
-			c.lru.Remove(elem)
-			entry.ListType = LFU
-			c.lfu.PushFront(entry) // 因为 PushFront 是接受一个新元素 所以这里要用 entry
-			c.cache[key] = c.lfu.Front()
-		
-		case LFU:
-			c.lfu.MoveToFront(elem)
+			c.move(entry, LFU)
+			return
 
 		case RG:
+			// lru 太小了 把 p 调大
 			delta := 1
-			if c.lru_ghost.Len() < c.lfu_ghost.Len() {
-				delta = c.lfu_ghost.Len() / c.lru_ghost.Len()
+			if c.lru_ghost.len < c.lfu_ghost.len {
+				delta = c.lfu_ghost.len / c.lru_ghost.len
 			}
-
 			c.p = c.min(c.p+delta, c.capacity)
-			c.replace(key)
+			c.replace(false)
 
-			entry := elem.Value.(*ARCEntry)
-			entry.value = value
-			entry.ListType = LRU
-			c.lru_ghost.Remove(elem)
-			c.lru.PushFront(entry)
-			c.cache[key] = c.lru.Front()
-		
 		case FG:
+			// lfu 太小了 把 p 调小
 			delta := 1
-			if c.lru_ghost.Len() > c.lfu_ghost.Len() {
-				delta = c.lru_ghost.Len() / c.lfu_ghost.Len()
+			if c.lfu_ghost.len < c.lru_ghost.len {
+				delta = c.lru_ghost.len / c.lfu_ghost.len
 			}
-
 			c.p = c.max(c.p-delta, 0)
-
-			c.replace(key)
-
-			entry := elem.Value.(*ARCEntry)
-			entry.value = value
-			entry.ListType = LFU
-			c.lfu_ghost.Remove(elem)
-			c.lru.PushFront(entry)
-			c.cache[key] = c.lru.Front()
+			c.replace(true)
 		}
+		entry.value = value
+		c.move(entry, LFU)
+		return
 	}
 
 	// 未命中 这是一个新元素
 
 	// 驱逐 lru 中的元素
-	if c.lru.Len()+c.lru_ghost.Len() == c.capacity {
-		if c.lru.Len() < c.capacity {
+	if c.lru.len+c.lru_ghost.len == c.capacity {
+		if c.lru.len < c.capacity {
 			// 从 ghost 中淘汰
-			c.removeLRU(c.lru_ghost)
-			c.replace(key)
+			c.removeOldest(&c.lru_ghost)
+			c.replace(false)
 		} else {
 			// c.lru == c.capacity
 			// 从 lru 中淘汰
-			c.removeLRU(c.lru)
+			c.removeOldest(&c.lru)
 		}
 	} else {
 		// lru + lru_ghost < capacity
@@ -143,99 +203,84 @@ func (c *ARCCache) Add(key Key, value interface{}) {
 		// 但是需要维护链表
 		// 也就是如果总长度是两倍的capacity
 		// 那么就需要驱逐lfu中的元素
-		totalLen := c.lru.Len() + c.lru_ghost.Len() + c.lfu.Len() + c.lfu_ghost.Len()
+		totalLen := c.lru.len + c.lru_ghost.len + c.lfu.len + c.lfu_ghost.len
 		if totalLen >= c.capacity {
 			if totalLen == 2*c.capacity {
-				c.removeLRU(c.lfu_ghost)
+				c.removeOldest(&c.lfu_ghost)
 			}
-			c.replace(key)
+			c.replace(false)
 		}
 	}
 
-	newEntry := &ARCEntry{
-		key: key,
-		value: value,
-		ListType: LRU,
-	}
-
-	c.lru.PushFront(newEntry)
-	c.cache[key] = c.lru.Front()
+	entry := &arcEntry[K, V]{key: key, value: value, ListType: LRU}
+	c.lru.pushFront(entry)
+	c.cache[key] = entry
 }
 
-// get 函数是由副作用的 
+// get 函数是由副作用的
 // 如果命中在lru 中 那么将其放到lfu中
 // 如果已经在lfu中 那么将其提前
 // 这里不考虑按照命中次数排序
 // 有点太复杂了
 // 而且我不确定如果按照命中次数排序性能表现会不会更好
-func (c *ARCCache) Get(key Key) (value interface{}, ok bool) {
+func (c *ARC[K, V]) Get(key K) (value V, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if elem, ok := c.cache[key]; ok {
-		entry := elem.Value.(*ARCEntry)
-
-		if entry.ListType == LRU {
-			c.lru.Remove(elem)
-			c.lfu.PushFront(entry)
-			c.cache[key] = c.lfu.Front()
-		} else {
-			c.lfu.MoveToFront(elem)
-		}
-		
-		return entry.value, true
+	entry, ok := c.cache[key]
+	// ghost 里只有 key 没有值
+	if !ok || entry.ListType == RG || entry.ListType == FG {
+		return value, false
 	}
+	c.move(entry, LFU)
+	return entry.value, true
+}
 
-	// 不在缓存之内 
-	return
+// Len returns the number of entries with a value, in LRU and LFU.
+func (c *ARC[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.len + c.lfu.len
 }
 
+// replace makes room for one entry by moving the oldest entry of LRU or
+// LFU to its ghost list. inFG is whether the key being added was found
+// in FG.
 // 驱逐末尾的元素
-func (c *ARCCache) replace(key Key) {
-	lruLen := c.lru.Len()
-
-	inLFU := false
-	if elem, ok := c.cache[key]; ok && elem.Value.(*ARCEntry).ListType == LFU {
-		inLFU = true
-	}
-
-	if lruLen > 0 && (lruLen > c.p || (inLFU && lruLen == c.p)) {
-		lru := c.lru.Back()
-		entry := lru.Value.(*ARCEntry)
-		entry.value = nil
-		entry.ListType = RG
-
-		c.lru.Remove(lru)
-		c.lru_ghost.PushFront(entry)
-		c.cache[entry.key] = c.lru_ghost.Front()
+func (c *ARC[K, V]) replace(inFG bool) {
+	var zero V
+	var entry *arcEntry[K, V]
+	if lruLen := c.lru.len; lruLen > 0 && (lruLen > c.p || (inFG && lruLen == c.p) || c.lfu.len == 0) {
+		entry = c.lru.back()
+		c.move(entry, RG)
+	} else if entry = c.lfu.back(); entry != nil {
+		c.move(entry, FG)
 	} else {
-		lru := c.lfu.Back()
-		entry := lru.Value.(*ARCEntry)
-		entry.value = nil
-		entry.ListType = FG
-
-		c.lfu.Remove(lru)
-		c.lfu_ghost.PushFront(entry)
-		c.cache[entry.key] = c.lfu_ghost.Front()
+		return
+	}
+	if c.OnEvcted != nil {
+		c.OnEvcted(entry.key, entry.value)
 	}
+	entry.value = zero
 }
 
+// removeOldest drops the oldest entry of l from the cache.
 // 淘汰末尾的元素
-func (c *ARCCache) removeLRU(l *list.List) {
-	if l.Len() == 0 {
+func (c *ARC[K, V]) removeOldest(l *arcList[K, V]) {
+	entry := l.back()
+	if entry == nil {
 		return
 	}
 
-	lru := l.Back()
-	entry := lru.Value.(*ARCEntry)
+	l.remove(entry)
 	delete(c.cache, entry.key)
-	if c.OnEvcted != nil {
+	// ghost 里的 key 早就报告过了
+	if c.OnEvcted != nil && (entry.ListType == LRU || entry.ListType == LFU) {
 		c.OnEvcted(entry.key, entry.value)
 	}
-	l.Remove(lru)
 }
 
-func (c *ARCCache) min(i int, j int) int {
+func (c *ARC[K, V]) min(i int, j int) int {
 	if i < j {
 		return i
 	} else {
@@ -243,7 +288,7 @@ func (c *ARCCache) min(i int, j int) int {
 	}
 }
 
-func (c *ARCCache) max(i, j int) int {
+func (c *ARC[K, V]) max(i, j int) int {
 	if i > j {
 		return i
 	} else {
@@ -1,120 +1,162 @@
 package cachepolicy
 
-import "container/list"
-
-// Cache is an LRU cache. It is not safe for concurrent access.
-
-type LRUCache struct {
+// TypedLRU is an LRU cache of values of type V under keys of type K. It is
+// not safe for concurrent access.
+//
+// Entries are linked through their own fields instead of a
+// container/list, so an Add makes one allocation and keys and values
+// are never boxed into interfaces.
+type TypedLRU[K comparable, V any] struct {
 	// zero means no limit
 	capacity int
 
 	// TODO
-	OnEvcted func(key Key, value interface{})
+	OnEvcted func(key K, value V)
 
-	ll    *list.List
-	cache map[interface{}]*list.Element
+	// root.next 是最新的 root.prev 是最旧的
+	root  lruEntry[K, V]
+	len   int
+	cache map[K]*lruEntry[K, V]
 }
 
-type LRUEntry struct {
-	key   Key
-	value interface{}
+type lruEntry[K comparable, V any] struct {
+	prev, next *lruEntry[K, V]
+	key        K
+	value      V
 }
 
-func LRUNew(max_entries int) *LRUCache {
-	if max_entries < 0 {
+// LRUCache is a TypedLRU with interface{} keys and values.
+type LRUCache = TypedLRU[Key, interface{}]
+
+// LRUEntry is an entry of an LRUCache.
+type LRUEntry = lruEntry[Key, interface{}]
+
+// NewLRU returns an LRU holding at most maxEntries entries, or any number
+// if maxEntries is 0.
+func NewLRU[K comparable, V any](maxEntries int) *TypedLRU[K, V] {
+	if maxEntries < 0 {
 		panic("capacity must > 0")
 	}
 
-	return &LRUCache{
-		capacity: max_entries,
-		ll:       list.New(),
-		cache:    make(map[interface{}]*list.Element),
+	c := &TypedLRU[K, V]{
+		capacity: maxEntries,
+		cache:    make(map[K]*lruEntry[K, V]),
 	}
+	c.root.next = &c.root
+	c.root.prev = &c.root
+	return c
+}
+
+func LRUNew(max_entries int) *LRUCache {
+	return NewLRU[Key, interface{}](max_entries)
 }
 
 // Add adds a value to the cache.
 // If the key exists, update the value
-func (c *LRUCache) Add(key Key, value interface{}) {
+func (c *TypedLRU[K, V]) Add(key K, value V) {
 	// Go 的结构体可以创建为 零值
 	// var c Cache
-	// 这个时候 c.ll c.cache == nil
+	// 这个时候 c.cache == nil
 	if c.cache == nil {
-		c.cache = make(map[interface{}]*list.Element)
-		c.ll = list.New()
+		c.cache = make(map[K]*lruEntry[K, V])
+		c.root.next = &c.root
+		c.root.prev = &c.root
 	}
 
 	// cache contains the key
 	// update the value
-	if ee, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ee)
-		ee.Value.(*LRUEntry).value = value
+	if e, ok := c.cache[key]; ok {
+		c.moveToFront(e)
+		e.value = value
 		return
 	}
 	// cache not contains the key
 	// add the new node
-	ele := c.ll.PushFront(&LRUEntry{key, value})
-	c.cache[key] = ele
-	if c.capacity != 0 && c.ll.Len() > c.capacity {
+	e := &lruEntry[K, V]{key: key, value: value}
+	c.pushFront(e)
+	c.cache[key] = e
+	if c.capacity != 0 && c.len > c.capacity {
 		c.RemoveOldest()
 	}
 }
 
-func (c *LRUCache) Get(key Key) (value interface{}, ok bool) {
+func (c *TypedLRU[K, V]) Get(key K) (value V, ok bool) {
 	if c.cache == nil {
 		return
 	}
 
-	if ele, hit := c.cache[key]; hit {
-		c.ll.MoveToFront(ele)
-		return ele.Value.(*LRUEntry).value, true
+	if e, hit := c.cache[key]; hit {
+		c.moveToFront(e)
+		return e.value, true
 	}
 	return
 }
 
-func (c *LRUCache) Remove(key Key) {
+func (c *TypedLRU[K, V]) Remove(key K) {
 	if c.cache == nil {
 		return
 	}
 
-	if ele, hit := c.cache[key]; hit {
-		c.removeElement(ele)
+	if e, hit := c.cache[key]; hit {
+		c.removeEntry(e)
 	}
 }
 
-func (c *LRUCache) RemoveOldest() {
+func (c *TypedLRU[K, V]) RemoveOldest() {
 	if c.cache == nil {
 		return
 	}
 
-	ele := c.ll.Back()
-	if ele != nil {
-		c.removeElement(ele)
+	if e := c.root.prev; e != &c.root {
+		c.removeEntry(e)
 	}
 }
 
-func (c *LRUCache) removeElement(ele *list.Element) {
-	c.ll.Remove(ele)
-	kv := ele.Value.(*LRUEntry)
-	delete(c.cache, kv.key)
+func (c *TypedLRU[K, V]) removeEntry(e *lruEntry[K, V]) {
+	c.unlink(e)
+	delete(c.cache, e.key)
 	if c.OnEvcted != nil {
-		c.OnEvcted(kv.key, kv.value)
+		c.OnEvcted(e.key, e.value)
 	}
 }
 
-func (c *LRUCache) Len() int {
+func (c *TypedLRU[K, V]) Len() int {
 	if c.cache == nil {
 		return 0
 	}
-	return c.ll.Len()
+	return c.len
 }
 
-func (c *LRUCache) Clear() {
+func (c *TypedLRU[K, V]) Clear() {
 	if c.OnEvcted != nil {
 		for _, e := range c.cache {
-			kv := e.Value.(*LRUEntry)
-			c.OnEvcted(kv.key, kv.value)
+			c.OnEvcted(e.key, e.value)
 		}
 	}
-	c.ll = nil
+	c.root = lruEntry[K, V]{}
+	c.len = 0
 	c.cache = nil
 }
+
+func (c *TypedLRU[K, V]) pushFront(e *lruEntry[K, V]) {
+	e.prev = &c.root
+	e.next = c.root.next
+	e.prev.next = e
+	e.next.prev = e
+	c.len++
+}
+
+func (c *TypedLRU[K, V]) unlink(e *lruEntry[K, V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+	c.len--
+}
+
+func (c *TypedLRU[K, V]) moveToFront(e *lruEntry[K, V]) {
+	if c.root.next == e {
+		return
+	}
+	c.unlink(e)
+	c.pushFront(e)
+}
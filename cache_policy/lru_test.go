@@ -2,6 +2,7 @@ package cachepolicy
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -80,4 +81,173 @@ func TestOnEvcted(t *testing.T) {
 	if evictedKeys[1] != Key("myKey1") {
 		t.Fatalf("got %v in second evicted key; want %s", evictedKeys[1], "myKey1")
 	}
-}
\ No newline at end of file
+}
+
+func TestLRUGeneric(t *testing.T) {
+	var evicted []int
+	lru := NewLRU[int, string](2)
+	lru.OnEvcted = func(key int, value string) {
+		evicted = append(evicted, key)
+	}
+	lru.Add(1, "one")
+	lru.Add(2, "two")
+	if v, ok := lru.Get(1); !ok || v != "one" {
+		t.Fatalf("Get(1) = %q, %v; want one", v, ok)
+	}
+	// 1 刚被访问 所以淘汰 2
+	lru.Add(3, "three")
+	if _, ok := lru.Get(2); ok {
+		t.Error("least recently used key 2 not evicted")
+	}
+	lru.Remove(1)
+	if len(evicted) != 2 || evicted[0] != 2 || evicted[1] != 1 {
+		t.Errorf("evicted %v; want [2 1]", evicted)
+	}
+	if lru.Len() != 1 {
+		t.Errorf("Len = %d; want 1", lru.Len())
+	}
+	lru.Clear()
+	if lru.Len() != 0 || len(evicted) != 3 {
+		t.Errorf("after Clear Len = %d, evicted %v", lru.Len(), evicted)
+	}
+
+	// 零值也可以使用
+	var zero TypedLRU[string, int]
+	zero.Add("a", 1)
+	zero.RemoveOldest()
+	if zero.Len() != 0 {
+		t.Errorf("zero value Len = %d after RemoveOldest; want 0", zero.Len())
+	}
+}
+
+func TestARCGeneric(t *testing.T) {
+	var evicted []string
+	arc := NewARC[string, int](2)
+	arc.OnEvcted = func(key string, value int) {
+		evicted = append(evicted, key)
+		if value == 0 {
+			t.Errorf("%s evicted without its value", key)
+		}
+	}
+	list := func(key string) (ListType, bool) {
+		e, ok := arc.cache[key]
+		if !ok {
+			return 0, false
+		}
+		return e.ListType, true
+	}
+	check := func(step string, want map[string]ListType) {
+		t.Helper()
+		for key, typ := range want {
+			if got, ok := list(key); !ok || got != typ {
+				t.Errorf("%s: %s in list %v, %v; want %v", step, key, got, ok, typ)
+			}
+		}
+	}
+
+	arc.Add("a", 1)
+	arc.Add("b", 2)
+	check("new keys", map[string]ListType{"a": LRU, "b": LRU})
+	if v, ok := arc.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %v; want 1", v, ok)
+	}
+	check("second use", map[string]ListType{"a": LFU, "b": LRU})
+
+	// 满了 淘汰 LRU 最旧的 b 只留下 key
+	arc.Add("c", 3)
+	check("add c", map[string]ListType{"a": LFU, "b": RG, "c": LRU})
+	if _, ok := arc.Get("b"); ok {
+		t.Error("Get(b) hit a ghost entry")
+	}
+
+	// 命中 RG 调大 p 淘汰 LFU 的 a
+	arc.Add("b", 2)
+	check("add b from RG", map[string]ListType{"a": FG, "b": LFU, "c": LRU})
+	if arc.p != 1 {
+		t.Errorf("p = %d after a hit in RG; want 1", arc.p)
+	}
+
+	// 命中 FG 调小 p 淘汰 LRU 的 c
+	arc.Add("a", 1)
+	check("add a from FG", map[string]ListType{"a": LFU, "b": LFU, "c": RG})
+	if arc.p != 0 {
+		t.Errorf("p = %d after a hit in FG; want 0", arc.p)
+	}
+
+	arc.Add("d", 4)
+	check("add d", map[string]ListType{"a": LFU, "b": FG, "c": RG, "d": LRU})
+
+	// LRU 和 RG 一共 capacity 个 丢掉 RG 最旧的 c
+	arc.Add("e", 5)
+	check("add e", map[string]ListType{"a": LFU, "b": FG, "d": RG, "e": LRU})
+	if _, ok := list("c"); ok {
+		t.Error("c still remembered after RG was trimmed")
+	}
+
+	if want := []string{"b", "a", "c", "b", "d"}; !reflect.DeepEqual(evicted, want) {
+		t.Errorf("evicted %q; want %q", evicted, want)
+	}
+	if arc.Len() != 2 {
+		t.Errorf("Len = %d; want 2", arc.Len())
+	}
+	for key, want := range map[string]int{"a": 1, "e": 5} {
+		if v, ok := arc.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %d, %v; want %d", key, v, ok, want)
+		}
+	}
+}
+
+// BenchmarkARCAdd adds new keys to a full ARC. The container/list ARC
+// made 2 allocs, 72 B per Add: the entry and the list element boxing it.
+// Linked through their own fields, entries make 1, 48 B.
+func BenchmarkARCAdd(b *testing.B) {
+	b.ReportAllocs()
+	arc := NewARC[int, int](1000)
+	for i := 0; i < b.N; i++ {
+		arc.Add(i, i)
+	}
+}
+
+// BenchmarkLRUCacheAdd measures TypedLRU through the LRUCache alias.
+// The container/list LRUCache it replaced made 3 allocs, 96 B per Add;
+// the alias makes 2, 64 B, and TypedLRU[int, int] 1, 32 B. Get was and
+// is allocation free.
+func BenchmarkLRUCacheAdd(b *testing.B) {
+	b.ReportAllocs()
+	lru := LRUNew(1000)
+	for i := 0; i < b.N; i++ {
+		lru.Add(i, i)
+	}
+}
+
+func BenchmarkTypedLRUAdd(b *testing.B) {
+	b.ReportAllocs()
+	lru := NewLRU[int, int](1000)
+	for i := 0; i < b.N; i++ {
+		lru.Add(i, i)
+	}
+}
+
+func BenchmarkLRUCacheGet(b *testing.B) {
+	b.ReportAllocs()
+	lru := LRUNew(0)
+	for i := 0; i < 1000; i++ {
+		lru.Add(i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lru.Get(i % 1000)
+	}
+}
+
+func BenchmarkTypedLRUGet(b *testing.B) {
+	b.ReportAllocs()
+	lru := NewLRU[int, int](0)
+	for i := 0; i < 1000; i++ {
+		lru.Add(i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lru.Get(i % 1000)
+	}
+}
@@ -0,0 +1,109 @@
+package groupcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/gcache/groupcachetest"
+)
+
+func TestFakeClockDrivesExpiryAndStats(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	clk := groupcachetest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	var loads int
+	g, err := r.NewGroupWithOptions("g", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		clk.Advance(3 * time.Millisecond) // 加载耗时
+		return dest.SetString("v")
+	}), WithCacheBytes(1<<20), WithPeers(NoPeers{}), WithClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetRefreshOptions(RefreshOptions{TTL: time.Minute})
+
+	var s string
+	get := func() {
+		t.Helper()
+		if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get()
+	clk.Advance(time.Minute - time.Nanosecond)
+	get()
+	if loads != 1 {
+		t.Fatalf("loads = %d before the TTL passed; want 1", loads)
+	}
+	clk.Advance(time.Nanosecond)
+	get()
+	if loads != 2 {
+		t.Errorf("loads = %d after the TTL passed; want 2", loads)
+	}
+
+	// 延迟也按 clock 计算 结果是确定的
+	s2 := g.Stats.LocalLoadLatency.Snapshot()
+	if s2.Count != 2 || s2.Sum != 6*time.Millisecond {
+		t.Errorf("LocalLoadLatency count %d sum %v; want 2 and 6ms", s2.Count, s2.Sum)
+	}
+	if q := s2.Quantile(1); q != bucketBound(bucketOf(3*time.Millisecond)) {
+		t.Errorf("LocalLoadLatency max bucket = %v", q)
+	}
+}
+
+func TestRandSeed(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	hotPicks := func(name string) []bool {
+		g, err := r.NewGroupWithOptions(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			return nil
+		}), WithCacheBytes(1<<20), WithRandSeed(42))
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.SetHotKeyOptions(HotKeyOptions{Threshold: -1})
+		var picks []bool
+		for i := 0; i < 50; i++ {
+			before := g.hotCache.items()
+			g.maybePopulateHotCache(cacheKey{key: string(rune('a' + i))}, 0, ByteView{s: "v"})
+			picks = append(picks, g.hotCache.items() > before)
+		}
+		return picks
+	}
+	a, b := hotPicks("a"), hotPicks("b")
+	var n int
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("pick %d differs between groups with the same seed", i)
+		}
+		if a[i] {
+			n++
+		}
+	}
+	if n == 0 || n == len(a) {
+		t.Errorf("%d of %d values went into the hot cache; want some", n, len(a))
+	}
+}
+
+func TestFakeClockDrivesCacheExpiry(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	clk := groupcachetest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	g, err := r.NewGroupWithOptions("g", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), WithCacheBytes(1<<20), WithPeers(NoPeers{}), WithClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 缓存的过期也按 group 的 clock 判断
+	g.mainCache.add(g.cacheKey("e"), ByteView{s: "v", e: clk.Now().Add(time.Minute)})
+	if _, ok := g.mainCache.get(g.cacheKey("e")); !ok {
+		t.Fatal("entry expired before its time")
+	}
+	clk.Advance(time.Minute)
+	if _, ok := g.mainCache.get(g.cacheKey("e")); ok {
+		t.Error("entry not expired on the group's clock")
+	}
+}
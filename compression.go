@@ -0,0 +1,223 @@
+package groupcache
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Compressor compresses cached values.
+type Compressor interface {
+	// Name identifies the format to peers. Peers only exchange
+	// compressed values when their compressors have the same name.
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// FlateCompressor compresses with compress/flate.
+type FlateCompressor struct {
+	// Level is a compress/flate level. 0 means flate.DefaultCompression.
+	Level int
+
+	// MaxSize caps the size of a decompressed value, so a peer cannot
+	// make this process inflate a small value into a huge one.
+	// Decompress fails on larger values. If 0, it defaults to 64 MiB.
+	MaxSize int
+}
+
+const defaultMaxDecompressed = 64 << 20
+
+var errDecompressedTooLarge = errors.New("groupcache: decompressed value larger than MaxSize")
+
+func (FlateCompressor) Name() string { return "flate" }
+
+func (c FlateCompressor) Compress(src []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c FlateCompressor) Decompress(src []byte) ([]byte, error) {
+	max := c.MaxSize
+	if max <= 0 {
+		max = defaultMaxDecompressed
+	}
+	// 多读一个字节 判断是否超过上限
+	b, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(src)), int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > max {
+		return nil, errDecompressedTooLarge
+	}
+	return b, nil
+}
+
+// CompressionOptions configures how a group compresses its values.
+type CompressionOptions struct {
+	// Compressor compresses the values. If nil, it defaults to
+	// FlateCompressor{}.
+	Compressor Compressor
+
+	// Threshold is the length from which values are compressed. Shorter
+	// values, and values that do not get shorter, are cached as they
+	// are. If 0, it defaults to 1024.
+	Threshold int
+
+	// Peers also exchanges compressed values with peers. An owner sends
+	// a value that it caches compressed as it is, and the peer keeps it
+	// compressed in its hot cache; values the owner does not cache
+	// compressed are sent uncompressed. Both sides need the same
+	// Compressor and Peers set. Batched requests, see BatchProtoGetter, always
+	// move values uncompressed.
+	Peers bool
+}
+
+const defaultCompressionThreshold = 1024
+
+func (o CompressionOptions) withDefaults() CompressionOptions {
+	if o.Compressor == nil {
+		o.Compressor = FlateCompressor{}
+	}
+	if o.Threshold == 0 {
+		o.Threshold = defaultCompressionThreshold
+	}
+	return o
+}
+
+// WithCompression makes the group keep values of at least o.Threshold
+// bytes compressed in its caches. Cache bytes count the compressed size;
+// values are decompressed when they are read into a Sink.
+func WithCompression(o CompressionOptions) GroupOption {
+	return func(c *groupConfig) {
+		c.compression, c.compressionSet = o, true
+	}
+}
+
+// compress returns the view to cache for value.
+func (g *Group) compress(value ByteView) ByteView {
+	c := g.compression
+	if c == nil || value.z || value.Len() < c.Threshold {
+		return value
+	}
+	b := value.b
+	if b == nil {
+		b = []byte(value.s)
+	}
+	z, err := c.Compressor.Compress(b)
+	// 压缩失败或者没有变小就原样存放
+	if err != nil || len(z) >= value.Len() {
+		return value
+	}
+	return ByteView{b: z, e: value.e, z: true}
+}
+
+// decompress returns the value of a view read from a cache.
+func (g *Group) decompress(value ByteView) (ByteView, error) {
+	if !value.z {
+		return value, nil
+	}
+	if g.compression == nil {
+		return ByteView{}, errors.New("groupcache: compressed value without a compressor")
+	}
+	b, err := g.compression.Compressor.Decompress(value.b)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: b, e: value.e}, nil
+}
+
+// compressionField is the unknown field that carries a compressor name:
+// in a GetRequest the format the caller accepts, in a GetResponse the
+// format of Value.
+const compressionField = 13
+
+// acceptCompression returns the request fields that ask a peer for a
+// compressed value.
+func (g *Group) acceptCompression(b []byte) []byte {
+	if g.compression == nil || !g.compression.Peers {
+		return b
+	}
+	b = protowire.AppendTag(b, compressionField, protowire.BytesType)
+	return protowire.AppendString(b, g.compression.Compressor.Name())
+}
+
+// peerResponse is the response to a peer's Get of view, as returned by
+// peerGet. A view cached compressed is sent as it is if the peer accepts
+// this group's compression, and decompressed otherwise.
+func (g *Group) peerResponse(view ByteView, accept string) (*pb.GetResponse, error) {
+	res := &pb.GetResponse{
+		XXX_unrecognized: appendExpire(appendGeneration(nil, g.Generation()), view.e),
+	}
+	if c := g.compression; view.z && c != nil && c.Peers && accept == c.Compressor.Name() {
+		res.Value = view.b
+		res.XXX_unrecognized = protowire.AppendTag(res.XXX_unrecognized, compressionField, protowire.BytesType)
+		res.XXX_unrecognized = protowire.AppendString(res.XXX_unrecognized, c.Compressor.Name())
+		return res, nil
+	}
+	view, err := g.decompress(view)
+	if err != nil {
+		return nil, err
+	}
+	res.Value = view.bytes()
+	return res, nil
+}
+
+// responseValue returns the value of a peer's response. A compressed
+// value is returned compressed, to be cached as it is.
+func (g *Group) responseValue(res *pb.GetResponse) (ByteView, error) {
+	name, ok := compressionOf(res.XXX_unrecognized)
+	if !ok {
+		return ByteView{b: res.Value}, nil
+	}
+	c := g.compression
+	if c == nil || name != c.Compressor.Name() {
+		return ByteView{}, fmt.Errorf("groupcache: peer sent a value compressed with %q", name)
+	}
+	return ByteView{b: res.Value, z: true}, nil
+}
+
+// compressionOf returns the compressor name field of an encoded message.
+func compressionOf(b []byte) (name string, ok bool) {
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return
+		}
+		b = b[l:]
+		if n == compressionField && typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(b)
+			if l < 0 {
+				return
+			}
+			name, ok = string(v), true
+			b = b[l:]
+			continue
+		}
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		if l < 0 {
+			return
+		}
+		b = b[l:]
+	}
+	return
+}
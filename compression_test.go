@@ -0,0 +1,282 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// compressible is a value flate shrinks a lot.
+var compressible = strings.Repeat("groupcache ", 1000)
+
+func TestCompressionStoresCompressed(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	var loads int
+	g, err := r.NewGroupWithOptions("g", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads++
+		if key == "small" {
+			return dest.SetString("small")
+		}
+		return dest.SetString(compressible)
+	}), WithCacheBytes(1<<20), WithPeers(NoPeers{}), WithCompression(CompressionOptions{Threshold: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		var s string
+		if err := g.Get(context.TODO(), "big", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if s != compressible {
+			t.Fatalf("Get = %d bytes; want the %d bytes loaded", len(s), len(compressible))
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d; want 1", loads)
+	}
+	// 统计的是压缩后的大小
+	if got := g.CacheStats(MainCache).Bytes; got >= int64(len(compressible)) {
+		t.Errorf("main cache bytes = %d; want less than %d", got, len(compressible))
+	}
+
+	before := g.CacheStats(MainCache).Bytes
+	var s string
+	if err := g.Get(context.TODO(), "small", StringSink(&s)); err != nil || s != "small" {
+		t.Fatalf("Get(small) = %q, %v", s, err)
+	}
+	if got, want := g.CacheStats(MainCache).Bytes-before, int64(len("small")+len("small")); got != want {
+		t.Errorf("small value took %d bytes; want %d, stored as it is", got, want)
+	}
+}
+
+func TestCompressionDefaults(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	getter := GetterFunc(func(_ context.Context, key string, dest Sink) error { return nil })
+	g, err := r.NewGroupWithOptions("peers", getter, WithCompression(CompressionOptions{Peers: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.compression.Threshold != defaultCompressionThreshold || g.compression.Compressor.Name() != "flate" {
+		t.Errorf("defaults = %+v", *g.compression)
+	}
+}
+
+// countingCompressor is a FlateCompressor that counts its calls.
+type countingCompressor struct {
+	FlateCompressor
+	compressed, decompressed atomic.Int32
+}
+
+func (c *countingCompressor) Compress(src []byte) ([]byte, error) {
+	c.compressed.Add(1)
+	return c.FlateCompressor.Compress(src)
+}
+
+func (c *countingCompressor) Decompress(src []byte) ([]byte, error) {
+	c.decompressed.Add(1)
+	return c.FlateCompressor.Decompress(src)
+}
+
+// testCompressedPeer checks that client, a pool of peers serving reg's
+// groups, moves values compressed without compressing them again.
+func testCompressedPeer(t *testing.T, reg *Registry, client PeerPicker) {
+	t.Helper()
+	owner := &countingCompressor{}
+	if _, err := reg.NewGroupWithOptions("z", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(compressible)
+	}), WithCacheBytes(1<<20), WithPeers(NoPeers{}), WithCompression(CompressionOptions{Compressor: owner, Threshold: 100, Peers: true})); err != nil {
+		t.Fatal(err)
+	}
+	requester := &countingCompressor{}
+	g, err := newTestRegistry(t).NewGroupWithOptions("z", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), WithCacheBytes(1<<20), WithPeers(client), WithCompression(CompressionOptions{Compressor: requester, Threshold: 100, Peers: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	peer, ok := client.PickPeer("k")
+	if !ok {
+		t.Fatal("no peer")
+	}
+	key := "k"
+
+	// 不要求压缩的请求拿到原值 拥有者加载后压缩存放
+	res := &pb.GetResponse{}
+	if err := peer.Get(ctx, &pb.GetRequest{Group: &g.name, Key: &key}, res); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := compressionOf(res.XXX_unrecognized); ok || string(res.Value) != compressible {
+		t.Errorf("plain request got a compressed value of %d bytes", len(res.Value))
+	}
+
+	for i := 0; i < 3; i++ {
+		res = &pb.GetResponse{}
+		err = peer.Get(ctx, &pb.GetRequest{Group: &g.name, Key: &key, XXX_unrecognized: g.acceptCompression(nil)}, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name, ok := compressionOf(res.XXX_unrecognized); !ok || name != "flate" {
+			t.Errorf("response compression = %q, %v; want flate", name, ok)
+		}
+		if len(res.Value) >= len(compressible) {
+			t.Errorf("peer sent %d bytes; want fewer than %d", len(res.Value), len(compressible))
+		}
+	}
+	// 拥有者只在写入缓存时压缩一次 发送的是缓存里的字节
+	if n := owner.compressed.Load(); n != 1 {
+		t.Errorf("owner compressed %d times; want once, when caching", n)
+	}
+
+	// 请求方原样把压缩的值放进 hotCache
+	value, err := g.getFromPeer(ctx, peer, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !value.z || len(value.b) >= len(compressible) {
+		t.Fatalf("getFromPeer returned %d bytes, compressed %v; want the compressed bytes", value.Len(), value.z)
+	}
+	g.populateCache(g.cacheKey("k"), value, &g.hotCache)
+	if n := requester.compressed.Load(); n != 0 {
+		t.Errorf("requester compressed %d times; want none", n)
+	}
+	if st := g.CacheStats(HotCache); st.Bytes >= int64(len(compressible)) {
+		t.Errorf("hot cache holds %d bytes; want the compressed size", st.Bytes)
+	}
+
+	var s string
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != compressible {
+		t.Errorf("Get = %d bytes; want the owner's %d", len(s), len(compressible))
+	}
+}
+
+func TestCompressionHTTPPeers(t *testing.T) {
+	t.Parallel()
+	reg := newTestRegistry(t)
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: reg}))
+	defer ts.Close()
+
+	client := newHTTPPool("http://client", nil)
+	client.Set(ts.URL)
+	testCompressedPeer(t, reg, client)
+}
+
+func TestCompressionGRPCPeers(t *testing.T) {
+	t.Parallel()
+	reg := newTestRegistry(t)
+	lis := startBufconnServer(t, newGRPCPool("owner", &GRPCPoolOptions{Registry: reg}))
+
+	client := newGRPCPool("client", &GRPCPoolOptions{DialOptions: bufconnDialOptions(lis)})
+	defer client.Close()
+	client.Set("passthrough:///owner")
+	testCompressedPeer(t, reg, client)
+}
+
+func TestCompressionOfUnknownFormat(t *testing.T) {
+	t.Parallel()
+	g := &Group{}
+	res := &pb.GetResponse{Value: []byte("x"), XXX_unrecognized: (&Group{compression: &CompressionOptions{Compressor: FlateCompressor{}, Peers: true}}).acceptCompression(nil)}
+	if _, err := g.responseValue(res); err == nil {
+		t.Error("value compressed with an unknown format accepted")
+	}
+}
+
+func TestFlateMaxSize(t *testing.T) {
+	t.Parallel()
+	z, err := FlateCompressor{}.Compress([]byte(compressible))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (FlateCompressor{MaxSize: len(compressible) - 1}).Decompress(z); !errors.Is(err, errDecompressedTooLarge) {
+		t.Errorf("Decompress over MaxSize = %v; want errDecompressedTooLarge", err)
+	}
+	b, err := FlateCompressor{MaxSize: len(compressible)}.Decompress(z)
+	if err != nil || string(b) != compressible {
+		t.Errorf("Decompress at MaxSize = %d bytes, %v", len(b), err)
+	}
+}
+
+// corruptPeer answers every Get with a value that claims to be flate
+// compressed but is not.
+type corruptPeer struct{}
+
+func (corruptPeer) Get(_ context.Context, _ *pb.GetRequest, res *pb.GetResponse) error {
+	res.Value = []byte("not flate")
+	res.XXX_unrecognized = (&Group{compression: &CompressionOptions{Compressor: FlateCompressor{}, Peers: true}}).acceptCompression(nil)
+	return nil
+}
+
+func TestCompressionCorruptPeerFallsBack(t *testing.T) {
+	t.Parallel()
+	g, err := newTestRegistry(t).NewGroupWithOptions("corrupt", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), WithCacheBytes(1<<20), WithPeers(keyPicker{peer: corruptPeer{}}), WithCompression(CompressionOptions{Peers: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil || s != "local" {
+		t.Fatalf("Get = %q, %v; want the local value", s, err)
+	}
+	if n := g.Stats.PeerErrors.Get(); n != 1 {
+		t.Errorf("PeerErrors = %d; want 1", n)
+	}
+	if st := g.CacheStats(HotCache); st.Items != 0 {
+		t.Errorf("hot cache holds %d items; want none", st.Items)
+	}
+}
+
+// lockCheckCompressor records whether inval.mu was held while it ran.
+type lockCheckCompressor struct {
+	FlateCompressor
+	g      *Group
+	locked atomic.Bool
+}
+
+func (c *lockCheckCompressor) Compress(src []byte) ([]byte, error) {
+	if c.g.inval.mu.TryLock() {
+		c.g.inval.mu.Unlock()
+	} else {
+		c.locked.Store(true)
+	}
+	return c.FlateCompressor.Compress(src)
+}
+
+func TestCompressionOutsideInvalidationLock(t *testing.T) {
+	t.Parallel()
+	z := &lockCheckCompressor{}
+	g, err := newTestRegistry(t).NewGroupWithOptions("unlocked", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(compressible)
+	}), WithCacheBytes(1<<20), WithPeers(NoPeers{}), WithCompression(CompressionOptions{Compressor: z, Threshold: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.g = g
+	var s string
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Set(context.TODO(), "k", []byte(compressible), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if z.locked.Load() {
+		t.Error("Compress ran while holding the invalidation lock")
+	}
+	if st := g.CacheStats(MainCache); st.Bytes >= int64(len(compressible)) {
+		t.Errorf("main cache bytes = %d; want the compressed size", st.Bytes)
+	}
+}
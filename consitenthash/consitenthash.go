@@ -3,53 +3,86 @@ package consitenthash
 
 import (
 	"hash/crc32"
-	"strconv"
 	"sort"
+	"strconv"
 )
 
 // You can specify your own hash function
 type Hash func([]byte) uint32
 
+// Hash64 is a 64-bit hash function. A wider hash spreads virtual nodes
+// more evenly when there are many replicas and nodes.
+type Hash64 func([]byte) uint64
+
+// vnode is one virtual node on the ring.
+// 哈希值和节点下标放在一起 查找时不再需要 map
+type vnode struct {
+	hash uint64
+	node int
+}
+
 type Map struct {
-	// 存放哈希值
-	keys 		[]int
-	// 建立哈希值和value 之间的映射
-	hashMap 	map[int]string
-	hash 		Hash
+	// 按哈希值排序的虚拟节点
+	ring 		[]vnode
+	// 真实节点 vnode.node 是它的下标
+	nodes 		[]string
+	hash 		Hash64
 	replicas	int
 }
 
 func New(replicas int, fn Hash) *Map {
-	m := &Map{
-		hashMap: 	make(map[int]string),
-		replicas: 	replicas,
-		hash:		fn,
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+
+	return newMap(replicas, func(data []byte) uint64 {
+		return uint64(fn(data))
+	})
+}
+
+// New64 is like New but hashes with a 64-bit function.
+// If fn is nil, 64-bit FNV-1a is used.
+func New64(replicas int, fn Hash64) *Map {
+	if fn == nil {
+		fn = fnv64a
 	}
+	return newMap(replicas, fn)
+}
 
-	if m.hash == nil {
-		m.hash = crc32.ChecksumIEEE
+func newMap(replicas int, fn Hash64) *Map {
+	return &Map{
+		replicas: 	replicas,
+		hash:		fn,
 	}
-	return m
 }
 
 // IsEmpty return true if there are no item available
 func (m *Map) IsEmpty() bool {
-	return len(m.keys) == 0
+	return len(m.ring) == 0
 }
 
 // Add some keys to the hash
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
+		idx := len(m.nodes)
+		m.nodes = append(m.nodes, key)
 		for i := 0; i < m.replicas; i++ {
 			hashInput := strconv.Itoa(i) + key
-			hash := int(m.hash([]byte(hashInput)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+			m.ring = append(m.ring, vnode{
+				hash: m.hash([]byte(hashInput)),
+				node: idx,
+			})
 		}
 	}
-	// sort the keys 
+	// sort the ring
 	// In the Get function we can use binary search
-	sort.Ints(m.keys)
+	// 哈希冲突时后加入的节点排在前面 和原来 map 覆盖的行为保持一致
+	sort.SliceStable(m.ring, func(i, j int) bool {
+		if m.ring[i].hash != m.ring[j].hash {
+			return m.ring[i].hash < m.ring[j].hash
+		}
+		return m.ring[i].node > m.ring[j].node
+	})
 }
 
 // Get gets the closest item in the hash to the provided key
@@ -59,15 +92,70 @@ func (m *Map) Get(key string) string {
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key)))
+	return m.nodes[m.ring[m.search(key)].node]
+}
+
+// GetUsable walks the ring clockwise from the key's position and
+// returns the first node for which usable returns true, so keys of an
+// unusable node move to the node that would own them if it were gone.
+// It returns "" if no node is usable.
+func (m *Map) GetUsable(key string, usable func(node string) bool) string {
+	if m.IsEmpty() {
+		return ""
+	}
+
+	// 每个真实节点只检查一次
+	checked := make(map[int]bool)
+	start := m.search(key)
+	for i := 0; i < len(m.ring) && len(checked) < len(m.nodes); i++ {
+		idx := m.ring[(start+i)%len(m.ring)].node
+		if checked[idx] {
+			continue
+		}
+		checked[idx] = true
+		if usable(m.nodes[idx]) {
+			return m.nodes[idx]
+		}
+	}
+	return ""
+}
+
+// search returns the index in ring of the first replica at or after
+// the key's hash, wrapping around to 0.
+func (m *Map) search(key string) int {
+	hash := m.hash([]byte(key))
 
 	// Binary search for appropriate replica
 	// 找到最小的大于等于 hash 的节点
-	idx := sort.Search(len(m.keys), func(i int) bool {return m.keys[i] >= hash})
+	// 手写二分 避免 sort.Search 的闭包调用
+	lo, hi := 0, len(m.ring)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if m.ring[mid].hash < hash {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
 
-	if idx == len(m.keys) {
-		idx = 0
+	if lo == len(m.ring) {
+		lo = 0
 	}
+	return lo
+}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
 
-	return m.hashMap[m.keys[idx]]
+// fnv64a is the 64-bit FNV-1a hash.
+// 与 hash/fnv 结果相同 但不需要分配 hash.Hash64
+func fnv64a(data []byte) uint64 {
+	h := uint64(fnvOffset64)
+	for _, c := range data {
+		h ^= uint64(c)
+		h *= fnvPrime64
+	}
+	return h
 }
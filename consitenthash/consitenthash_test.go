@@ -2,6 +2,9 @@ package consitenthash
 
 import (
 	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"sort"
 	"strconv"
 	"testing"
 )
@@ -71,6 +74,143 @@ func TestConsistency(t *testing.T) {
 	}
 }
 
+func TestHashing64(t *testing.T) {
+	hash := New64(3, func(key []byte) uint64 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+
+		return uint64(i)
+	})
+
+	// Same ring as TestHashing, but the "hashes" are 64-bit
+	hash.Add("6", "4", "2")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+}
+
+func TestGetUsable(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+
+		return uint32(i)
+	})
+
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	all := func(string) bool { return true }
+	without := func(down ...string) func(string) bool {
+		return func(node string) bool {
+			for _, d := range down {
+				if node == d {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	tests := []struct {
+		key    string
+		usable func(string) bool
+		want   string
+	}{
+		{"11", all, "2"},
+		{"11", without("2"), "4"},
+		{"11", without("2", "4"), "6"},
+		{"25", without("6"), "2"},
+		{"11", without("2", "4", "6"), ""},
+	}
+	for i, tt := range tests {
+		if got := hash.GetUsable(tt.key, tt.usable); got != tt.want {
+			t.Errorf("%d. GetUsable(%s) = %q; want %q", i, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFNV64a(t *testing.T) {
+	for _, s := range []string{"", "a", "NodeA", "shard-127"} {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		if got, want := fnv64a([]byte(s)), h.Sum64(); got != want {
+			t.Errorf("fnv64a(%q) = %d; want %d", s, got, want)
+		}
+	}
+}
+
+func TestMatchesLegacy(t *testing.T) {
+	var nodes []string
+	for i := 0; i < 20; i++ {
+		nodes = append(nodes, fmt.Sprintf("node-%d", i))
+	}
+
+	hash := New(50, nil)
+	hash.Add(nodes...)
+	legacy := newLegacyMap(50)
+	legacy.Add(nodes...)
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if got, want := hash.Get(key), legacy.Get(key); got != want {
+			t.Fatalf("Get(%q) = %q; legacy ring says %q", key, got, want)
+		}
+	}
+}
+
+// legacyMap is the old []int + map[int]string ring
+// kept only to compare lookups and benchmarks against
+type legacyMap struct {
+	keys     []int
+	hashMap  map[int]string
+	replicas int
+}
+
+func newLegacyMap(replicas int) *legacyMap {
+	return &legacyMap{
+		hashMap:  make(map[int]string),
+		replicas: replicas,
+	}
+}
+
+func (m *legacyMap) Add(keys ...string) {
+	for _, key := range keys {
+		for i := 0; i < m.replicas; i++ {
+			hash := int(crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + key)))
+			m.keys = append(m.keys, hash)
+			m.hashMap[hash] = key
+		}
+	}
+	sort.Ints(m.keys)
+}
+
+func (m *legacyMap) Get(key string) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+	hash := int(crc32.ChecksumIEEE([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool { return m.keys[i] >= hash })
+	if idx == len(m.keys) {
+		idx = 0
+	}
+	return m.hashMap[m.keys[idx]]
+}
+
 func BenchmarkGet8(b *testing.B)   { benchmarkGet(b, 8) }
 func BenchmarkGet32(b *testing.B)  { benchmarkGet(b, 32) }
 func BenchmarkGet128(b *testing.B) { benchmarkGet(b, 128) }
@@ -92,4 +232,46 @@ func benchmarkGet(b *testing.B, shards int) {
     for i := 0; i < b.N; i++ {
         hash.Get(buckets[i&(shards-1)])
     }
-}
\ No newline at end of file
+}
+
+// 500 replicas x 200 nodes
+// legacy: 旧的 []int + map 实现
+// ring32 / ring64: 新实现分别使用 crc32 和 FNV-64a
+func BenchmarkLargeRingLegacy(b *testing.B) {
+	legacy := newLegacyMap(500)
+	legacy.Add(largeRingNodes()...)
+	benchmarkLargeRing(b, legacy.Get)
+}
+
+func BenchmarkLargeRing32(b *testing.B) {
+	hash := New(500, nil)
+	hash.Add(largeRingNodes()...)
+	benchmarkLargeRing(b, hash.Get)
+}
+
+func BenchmarkLargeRing64(b *testing.B) {
+	hash := New64(500, nil)
+	hash.Add(largeRingNodes()...)
+	benchmarkLargeRing(b, hash.Get)
+}
+
+func largeRingNodes() []string {
+	nodes := make([]string, 200)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("http://10.0.%d.%d:8080", i/256, i%256)
+	}
+	return nodes
+}
+
+func benchmarkLargeRing(b *testing.B, get func(string) string) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%d", i)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		get(keys[i&(len(keys)-1)])
+	}
+}
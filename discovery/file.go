@@ -0,0 +1,203 @@
+// Package discovery keeps the peer list of a PeerPicker up to date
+// so membership can change without restarting the process.
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PeerSetter receives the full peer list every time it changes.
+// *groupcache.HTTPPool implements it: Set rebuilds the consistent
+// hash ring and the per-peer getters.
+type PeerSetter interface {
+	Set(peers ...string)
+}
+
+const defaultInterval = 5 * time.Second
+
+// FileWatcher polls a local file for the peer list.
+//
+// The file holds either one base URL per line (blank lines and lines
+// starting with '#' are ignored) or JSON: a list of URLs or an object
+// of the form {"peers": [...]}.
+type FileWatcher struct {
+	// OnError optionally specifies a callback for errors while reading
+	// or parsing the file. The last good peer list stays in place.
+	OnError func(err error)
+
+	path     string
+	interval time.Duration
+	setter   PeerSetter
+
+	mu    sync.Mutex // guards raw and peers
+	raw   []byte     // last file content we looked at
+	peers []string   // last list pushed to setter
+
+	started  atomic.Bool
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewFileWatcher returns a watcher for path. Zero interval means 5s.
+func NewFileWatcher(path string, interval time.Duration, setter PeerSetter) *FileWatcher {
+	if setter == nil {
+		panic("nil PeerSetter")
+	}
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	return &FileWatcher{
+		path:     path,
+		interval: interval,
+		setter:   setter,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start loads the file once and then keeps polling it in the background.
+// If the first load fails nothing is started and the error is returned.
+func (w *FileWatcher) Start() error {
+	if err := w.Reload(); err != nil {
+		return err
+	}
+
+	w.started.Store(true)
+	go w.loop()
+	return nil
+}
+
+// Stop stops polling. It is safe to call more than once.
+func (w *FileWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	if w.started.Load() {
+		<-w.done
+	}
+}
+
+func (w *FileWatcher) loop() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.Reload(); err != nil && w.OnError != nil {
+				w.OnError(err)
+			}
+		}
+	}
+}
+
+// Reload reads the file now and pushes the peer list to the setter
+// if it changed since the last push.
+func (w *FileWatcher) Reload() error {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// 文件内容没变 直接返回
+	if w.peers != nil && bytes.Equal(data, w.raw) {
+		return nil
+	}
+
+	peers, err := ParsePeers(data)
+	if err != nil {
+		return fmt.Errorf("discovery: %s: %v", w.path, err)
+	}
+	w.raw = data
+
+	// 只是格式变化(注释 顺序)时不需要重建环
+	if slices.Equal(peers, w.peers) {
+		return nil
+	}
+	w.peers = peers
+	w.setter.Set(peers...)
+	return nil
+}
+
+// Peers returns the last peer list pushed to the setter.
+func (w *FileWatcher) Peers() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.peers)
+}
+
+// ParsePeers parses a peer list file. The result is sorted and
+// deduplicated. An empty list is an error: a file caught halfway
+// through being rewritten must not drop every peer.
+func ParsePeers(data []byte) ([]string, error) {
+	var peers []string
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		if err := json.Unmarshal(trimmed, &peers); err != nil {
+			return nil, err
+		}
+
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		var doc struct {
+			Peers []string `json:"peers"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, err
+		}
+		peers = doc.Peers
+
+	default:
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			peers = append(peers, line)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, peer := range peers {
+		peer = strings.TrimRight(strings.TrimSpace(peer), "/")
+		u, err := url.Parse(peer)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("peer %q is not a base URL", peer)
+		}
+		peers[i] = peer
+	}
+
+	if len(peers) == 0 {
+		return nil, errors.New("empty peer list")
+	}
+
+	slices.Sort(peers)
+	return slices.Compact(peers), nil
+}
@@ -0,0 +1,146 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSetter struct {
+	mu    sync.Mutex
+	calls [][]string
+}
+
+func (s *fakeSetter) Set(peers ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, peers)
+}
+
+func (s *fakeSetter) last() (peers []string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.calls) == 0 {
+		return nil, 0
+	}
+	return s.calls[len(s.calls)-1], len(s.calls)
+}
+
+func TestParsePeers(t *testing.T) {
+	want := []string{"http://10.0.0.1:8000", "http://10.0.0.2:8000"}
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"lines", "http://10.0.0.2:8000\nhttp://10.0.0.1:8000\n"},
+		{"comments", "# cache nodes\n\nhttp://10.0.0.1:8000/\n  http://10.0.0.2:8000  \n"},
+		{"duplicates", "http://10.0.0.1:8000\nhttp://10.0.0.2:8000\nhttp://10.0.0.1:8000\n"},
+		{"json_list", `["http://10.0.0.2:8000", "http://10.0.0.1:8000"]`},
+		{"json_object", `{"peers": ["http://10.0.0.1:8000", "http://10.0.0.2:8000"]}`},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePeers([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: ParsePeers error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: ParsePeers = %q; want %q", tt.name, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "# nothing\n", "[]", `["http://a:1"`, "10.0.0.1:8000"} {
+		if got, err := ParsePeers([]byte(in)); err == nil {
+			t.Errorf("ParsePeers(%q) = %q; want error", in, got)
+		}
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	writeFile(t, path, "http://a:8000\nhttp://b:8000\n")
+
+	setter := &fakeSetter{}
+	errc := make(chan error, 16)
+	w := NewFileWatcher(path, 10*time.Millisecond, setter)
+	w.OnError = func(err error) {
+		select {
+		case errc <- err:
+		default:
+		}
+	}
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	if got, n := setter.last(); n != 1 || !reflect.DeepEqual(got, []string{"http://a:8000", "http://b:8000"}) {
+		t.Fatalf("after Start: %d calls, last %q", n, got)
+	}
+
+	// 成员变化 应该被推送
+	writeFile(t, path, "http://a:8000\nhttp://c:8000\n")
+	waitFor(t, func() bool {
+		got, _ := setter.last()
+		return reflect.DeepEqual(got, []string{"http://a:8000", "http://c:8000"})
+	})
+
+	// 只改注释 不应该重建
+	_, before := setter.last()
+	writeFile(t, path, "# reordered\nhttp://c:8000\nhttp://a:8000\n")
+	time.Sleep(50 * time.Millisecond)
+	if _, n := setter.last(); n != before {
+		t.Errorf("formatting-only change pushed %d times; want 0", n-before)
+	}
+
+	// 解析失败 保留上一次的列表
+	writeFile(t, path, "")
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+		t.Fatal("no error reported for empty file")
+	}
+	if got := w.Peers(); !reflect.DeepEqual(got, []string{"http://a:8000", "http://c:8000"}) {
+		t.Errorf("Peers after bad file = %q; want last good list", got)
+	}
+
+	writeFile(t, path, `{"peers": ["http://d:8000"]}`)
+	waitFor(t, func() bool {
+		got, _ := setter.last()
+		return reflect.DeepEqual(got, []string{"http://d:8000"})
+	})
+}
+
+func TestFileWatcherStartError(t *testing.T) {
+	w := NewFileWatcher(filepath.Join(t.TempDir(), "missing"), time.Millisecond, &fakeSetter{})
+	if err := w.Start(); err == nil {
+		t.Fatal("Start succeeded on a missing file")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	// 先写临时文件再 rename 和运维工具的做法一致
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,703 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Gossip is a SWIM-style membership protocol over UDP.
+//
+// Every ProbeInterval a node pings one member. If no ack arrives within
+// ProbeTimeout it asks IndirectProbes other members to ping the target
+// for it. A target nobody can reach is marked suspect and, unless it
+// refutes the suspicion, dead after SuspectTimeout. Dead members are
+// forgotten after DeadTimeout. Membership changes ride along on ping/ack
+// packets instead of being flooded.
+//
+// The live membership (alive and suspect members, including this node)
+// is pushed to the PeerSetter, so the peer ring follows the cluster.
+type Gossip struct {
+	// OnError optionally specifies a callback for network and decoding
+	// errors. They never stop the protocol.
+	OnError func(err error)
+
+	cfg    GossipConfig
+	setter PeerSetter
+	conn   *net.UDPConn
+	addr   string // advertised UDP address
+
+	mu          sync.Mutex
+	incarnation uint64
+	members     map[string]*member // keyed by Name, includes this node
+	broadcasts  []*broadcast
+	probeOrder  []string
+	probeIdx    int
+	seq         uint64
+	acks        map[uint64]chan struct{} // probes waiting for an ack
+	relays      map[uint64]relay         // ping-req we are probing for others
+	pushed      []string
+
+	// drop, if set, discards outgoing packets. Tests use it to cut links.
+	drop func(to string, m *message) bool
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// GossipConfig configures a Gossip node. Zero durations take defaults.
+type GossipConfig struct {
+	// Name is what the node contributes to the peer ring,
+	// e.g. its HTTPPool base URL "http://10.0.0.1:8000".
+	Name string
+
+	// BindAddr is the UDP address to listen on, e.g. ":7946".
+	BindAddr string
+
+	// AdvertiseAddr is the UDP address other nodes use to reach this one.
+	// If blank, the bound address is used.
+	AdvertiseAddr string
+
+	// Seeds are UDP addresses of existing members to join through.
+	// Leave it empty for the first node of a cluster.
+	Seeds []string
+
+	ProbeInterval  time.Duration // default 1s
+	ProbeTimeout   time.Duration // default ProbeInterval / 2
+	SuspectTimeout time.Duration // default 5 * ProbeInterval
+	IndirectProbes int           // default 3
+
+	// DeadTimeout is how long a dead member is remembered, so stale
+	// updates about it are recognized, before it is removed. A member
+	// that comes back afterwards joins again like a new one. Default
+	// 30 * ProbeInterval.
+	DeadTimeout time.Duration
+}
+
+// MemberState is the failure detector's opinion of a member.
+type MemberState int
+
+const (
+	StateAlive MemberState = iota
+	StateSuspect
+	StateDead
+)
+
+func (s MemberState) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	}
+	return fmt.Sprintf("MemberState(%d)", int(s))
+}
+
+// Member is one node as seen by the local node.
+type Member struct {
+	Name        string      `json:"name"`
+	Addr        string      `json:"addr"`
+	State       MemberState `json:"state"`
+	Incarnation uint64      `json:"inc"`
+}
+
+type member struct {
+	Member
+	suspectAt time.Time
+	deadAt    time.Time
+}
+
+type msgType int
+
+const (
+	msgPing msgType = iota
+	msgAck
+	msgPingReq
+	msgSync    // join: ask for the full member list
+	msgSyncAck // full member list
+	msgGossip  // updates only, no reply
+)
+
+type message struct {
+	Type    msgType  `json:"t"`
+	Seq     uint64   `json:"seq,omitempty"`
+	Target  string   `json:"target,omitempty"` // ping-req: address to probe
+	Updates []Member `json:"u,omitempty"`
+}
+
+type broadcast struct {
+	m         Member
+	transmits int
+}
+
+type relay struct {
+	addr string // who asked
+	seq  uint64 // their sequence number
+}
+
+const (
+	maxPiggyback   = 8
+	retransmitMult = 3
+	maxPacketSize  = 65536
+)
+
+// NewGossip binds the UDP socket. Call Start to join the cluster.
+func NewGossip(cfg GossipConfig, setter PeerSetter) (*Gossip, error) {
+	if setter == nil {
+		panic("nil PeerSetter")
+	}
+	if cfg.Name == "" {
+		return nil, errors.New("discovery: gossip needs a Name")
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = time.Second
+	}
+	if cfg.ProbeTimeout <= 0 || cfg.ProbeTimeout >= cfg.ProbeInterval {
+		cfg.ProbeTimeout = cfg.ProbeInterval / 2
+	}
+	if cfg.SuspectTimeout <= 0 {
+		cfg.SuspectTimeout = 5 * cfg.ProbeInterval
+	}
+	if cfg.IndirectProbes <= 0 {
+		cfg.IndirectProbes = 3
+	}
+	if cfg.DeadTimeout <= 0 {
+		cfg.DeadTimeout = 30 * cfg.ProbeInterval
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp", cfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Gossip{
+		cfg:    cfg,
+		setter: setter,
+		conn:   conn,
+		addr:   cfg.AdvertiseAddr,
+		// 重启后的节点用更大的 incarnation 覆盖旧的 dead 记录
+		incarnation: uint64(time.Now().UnixNano()),
+		members:     make(map[string]*member),
+		acks:        make(map[uint64]chan struct{}),
+		relays:      make(map[uint64]relay),
+		stop:        make(chan struct{}),
+	}
+	if g.addr == "" {
+		g.addr = conn.LocalAddr().String()
+	}
+	g.members[cfg.Name] = &member{Member: g.selfLocked()}
+	return g, nil
+}
+
+// Addr returns the advertised UDP address, useful as a seed for others.
+func (g *Gossip) Addr() string {
+	return g.addr
+}
+
+// Start pushes the initial membership, joins through the seeds and
+// starts probing. It fails if seeds were given but none answered.
+func (g *Gossip) Start() error {
+	g.mu.Lock()
+	g.pushLocked()
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go g.readLoop()
+
+	if len(g.cfg.Seeds) > 0 && !g.join() {
+		g.Stop()
+		return errors.New("discovery: no seed answered")
+	}
+
+	g.wg.Add(1)
+	go g.probeLoop()
+	return nil
+}
+
+// join asks every seed for its member list. Several rounds are tried
+// since UDP may lose the first packets.
+func (g *Gossip) join() bool {
+	for round := 0; round < 3; round++ {
+		seq, ack := g.expectAck()
+		for _, seed := range g.cfg.Seeds {
+			g.send(seed, &message{Type: msgSync, Seq: seq, Updates: []Member{g.self()}})
+		}
+
+		select {
+		case <-ack:
+			g.forget(seq)
+			return true
+		case <-time.After(g.cfg.ProbeInterval):
+			g.forget(seq)
+		case <-g.stop:
+			g.forget(seq)
+			return false
+		}
+	}
+	return false
+}
+
+// Leave tells the other members this node is going away, then stops.
+func (g *Gossip) Leave() {
+	g.mu.Lock()
+	g.incarnation++
+	self := g.selfLocked()
+	self.State = StateDead
+	var addrs []string
+	for _, m := range g.members {
+		if m.Name != g.cfg.Name && m.State != StateDead {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	g.mu.Unlock()
+
+	// 直接通知所有成员 不等 piggyback 慢慢传播
+	for _, addr := range addrs {
+		g.send(addr, &message{Type: msgGossip, Updates: []Member{self}})
+	}
+	g.Stop()
+}
+
+// Stop stops the protocol without telling anyone; the other members
+// find out through failure detection. It is safe to call more than once.
+func (g *Gossip) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.stop)
+		g.conn.Close()
+	})
+	g.wg.Wait()
+}
+
+// Members returns every known member, including dead ones not yet
+// removed after DeadTimeout.
+func (g *Gossip) Members() []Member {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	members := make([]Member, 0, len(g.members))
+	for _, m := range g.members {
+		members = append(members, m.Member)
+	}
+	slices.SortFunc(members, func(a, b Member) int {
+		if a.Name < b.Name {
+			return -1
+		}
+		if a.Name > b.Name {
+			return 1
+		}
+		return 0
+	})
+	return members
+}
+
+func (g *Gossip) self() Member {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.selfLocked()
+}
+
+func (g *Gossip) selfLocked() Member {
+	return Member{
+		Name:        g.cfg.Name,
+		Addr:        g.addr,
+		State:       StateAlive,
+		Incarnation: g.incarnation,
+	}
+}
+
+func (g *Gossip) readLoop() {
+	defer g.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := g.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-g.stop:
+				return
+			default:
+			}
+			g.error(err)
+			continue
+		}
+
+		var m message
+		if err := json.Unmarshal(buf[:n], &m); err != nil {
+			g.error(fmt.Errorf("discovery: bad packet from %v: %v", from, err))
+			continue
+		}
+		g.handle(&m, from.String())
+	}
+}
+
+func (g *Gossip) handle(m *message, from string) {
+	g.mu.Lock()
+	for _, u := range m.Updates {
+		g.applyLocked(u)
+	}
+	g.pushLocked()
+
+	switch m.Type {
+	case msgPing:
+		g.mu.Unlock()
+		g.send(from, &message{Type: msgAck, Seq: m.Seq})
+		return
+
+	case msgAck, msgSyncAck:
+		if ack, ok := g.acks[m.Seq]; ok {
+			// 同一个 seq 可能收到多个 ack (直接的和间接的)
+			select {
+			case ack <- struct{}{}:
+			default:
+			}
+		} else if r, ok := g.relays[m.Seq]; ok {
+			delete(g.relays, m.Seq)
+			g.mu.Unlock()
+			g.send(r.addr, &message{Type: msgAck, Seq: r.seq})
+			return
+		}
+
+	case msgPingReq:
+		g.seq++
+		seq := g.seq
+		g.relays[seq] = relay{addr: from, seq: m.Seq}
+		g.mu.Unlock()
+
+		time.AfterFunc(g.cfg.ProbeInterval, func() {
+			g.mu.Lock()
+			delete(g.relays, seq)
+			g.mu.Unlock()
+		})
+		g.send(m.Target, &message{Type: msgPing, Seq: seq})
+		return
+
+	case msgSync:
+		// dead 的成员对新节点没有用
+		updates := make([]Member, 0, len(g.members))
+		for _, mem := range g.members {
+			if mem.State != StateDead {
+				updates = append(updates, mem.Member)
+			}
+		}
+		g.mu.Unlock()
+		for _, part := range splitUpdates(updates) {
+			g.sendRaw(from, &message{Type: msgSyncAck, Seq: m.Seq, Updates: part})
+		}
+		return
+	}
+	g.mu.Unlock()
+}
+
+// applyLocked merges one membership update using the SWIM precedence
+// rules and queues it for further gossip if it changed anything.
+func (g *Gossip) applyLocked(u Member) {
+	if u.Name == g.cfg.Name {
+		// 有人怀疑我 用更大的 incarnation 反驳
+		if u.State != StateAlive && u.Incarnation >= g.incarnation {
+			g.incarnation = u.Incarnation + 1
+			self := g.selfLocked()
+			g.members[g.cfg.Name].Member = self
+			g.enqueueLocked(self)
+		}
+		return
+	}
+
+	m, ok := g.members[u.Name]
+	if ok {
+		switch u.State {
+		case StateAlive:
+			if u.Incarnation <= m.Incarnation {
+				return
+			}
+		case StateSuspect:
+			if u.Incarnation < m.Incarnation || (u.Incarnation == m.Incarnation && m.State != StateAlive) {
+				return
+			}
+		case StateDead:
+			if u.Incarnation < m.Incarnation || m.State == StateDead {
+				return
+			}
+		}
+	} else {
+		m = &member{}
+		g.members[u.Name] = m
+	}
+
+	m.Member = u
+	switch u.State {
+	case StateSuspect:
+		m.suspectAt = time.Now()
+	case StateDead:
+		m.deadAt = time.Now()
+	}
+	g.enqueueLocked(u)
+}
+
+// syncPacketBudget is the encoded size of the updates in one sync ack,
+// leaving room for the rest of the message.
+const syncPacketBudget = maxPacketSize - 1024
+
+// splitUpdates splits a member list into parts that each fit a packet.
+func splitUpdates(updates []Member) [][]Member {
+	var parts [][]Member
+	start, size := 0, 0
+	for i, u := range updates {
+		b, _ := json.Marshal(u)
+		n := len(b) + 1 // 逗号
+		if size+n > syncPacketBudget && i > start {
+			parts = append(parts, updates[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	return append(parts, updates[start:])
+}
+
+func (g *Gossip) enqueueLocked(u Member) {
+	// 同一个成员只保留最新的一条
+	g.broadcasts = slices.DeleteFunc(g.broadcasts, func(b *broadcast) bool {
+		return b.m.Name == u.Name
+	})
+	g.broadcasts = append(g.broadcasts, &broadcast{m: u})
+}
+
+// piggybackLocked picks the least transmitted updates for one packet.
+func (g *Gossip) piggybackLocked() []Member {
+	if len(g.broadcasts) == 0 {
+		return nil
+	}
+
+	limit := retransmitMult * int(math.Ceil(math.Log2(float64(len(g.members)+1))))
+	slices.SortStableFunc(g.broadcasts, func(a, b *broadcast) int {
+		return a.transmits - b.transmits
+	})
+
+	var updates []Member
+	for _, b := range g.broadcasts {
+		if len(updates) == maxPiggyback {
+			break
+		}
+		updates = append(updates, b.m)
+		b.transmits++
+	}
+	g.broadcasts = slices.DeleteFunc(g.broadcasts, func(b *broadcast) bool {
+		return b.transmits >= limit
+	})
+	return updates
+}
+
+// pushLocked sends the live membership to the setter when it changed.
+func (g *Gossip) pushLocked() {
+	var peers []string
+	for _, m := range g.members {
+		// suspect 的节点可能还活着 先不从环上摘掉
+		if m.State != StateDead {
+			peers = append(peers, m.Name)
+		}
+	}
+	slices.Sort(peers)
+
+	if g.pushed != nil && slices.Equal(peers, g.pushed) {
+		return
+	}
+	g.pushed = peers
+	g.setter.Set(peers...)
+}
+
+func (g *Gossip) probeLoop() {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(g.cfg.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			g.probe()
+			g.expireSuspects()
+			g.reapDead()
+		}
+	}
+}
+
+func (g *Gossip) probe() {
+	target, ok := g.nextTarget()
+	if !ok {
+		return
+	}
+
+	seq, ack := g.expectAck()
+	defer g.forget(seq)
+
+	g.send(target.Addr, &message{Type: msgPing, Seq: seq})
+	select {
+	case <-ack:
+		return
+	case <-time.After(g.cfg.ProbeTimeout):
+	case <-g.stop:
+		return
+	}
+
+	// 直接探测失败 请其他成员帮忙探测
+	for _, m := range g.randomMembers(g.cfg.IndirectProbes, target.Name) {
+		g.send(m.Addr, &message{Type: msgPingReq, Seq: seq, Target: target.Addr})
+	}
+	select {
+	case <-ack:
+		return
+	case <-time.After(g.cfg.ProbeInterval - g.cfg.ProbeTimeout):
+	case <-g.stop:
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if m, ok := g.members[target.Name]; ok && m.State == StateAlive && m.Incarnation == target.Incarnation {
+		g.applyLocked(Member{Name: m.Name, Addr: m.Addr, State: StateSuspect, Incarnation: m.Incarnation})
+		g.pushLocked()
+	}
+}
+
+func (g *Gossip) expireSuspects() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for _, m := range g.members {
+		if m.State == StateSuspect && now.Sub(m.suspectAt) >= g.cfg.SuspectTimeout {
+			g.applyLocked(Member{Name: m.Name, Addr: m.Addr, State: StateDead, Incarnation: m.Incarnation})
+		}
+	}
+	g.pushLocked()
+}
+
+// reapDead removes members that have been dead for DeadTimeout.
+func (g *Gossip) reapDead() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for name, m := range g.members {
+		if m.State == StateDead && name != g.cfg.Name && now.Sub(m.deadAt) >= g.cfg.DeadTimeout {
+			delete(g.members, name)
+		}
+	}
+}
+
+// nextTarget walks the members in a shuffled round-robin order,
+// reshuffling after each full pass.
+func (g *Gossip) nextTarget() (Member, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for tries := 0; tries < 2; tries++ {
+		for g.probeIdx < len(g.probeOrder) {
+			name := g.probeOrder[g.probeIdx]
+			g.probeIdx++
+			if m, ok := g.members[name]; ok && m.State != StateDead {
+				return m.Member, true
+			}
+		}
+
+		g.probeOrder = g.probeOrder[:0]
+		for name, m := range g.members {
+			if name != g.cfg.Name && m.State != StateDead {
+				g.probeOrder = append(g.probeOrder, name)
+			}
+		}
+		rand.Shuffle(len(g.probeOrder), func(i, j int) {
+			g.probeOrder[i], g.probeOrder[j] = g.probeOrder[j], g.probeOrder[i]
+		})
+		g.probeIdx = 0
+	}
+	return Member{}, false
+}
+
+func (g *Gossip) randomMembers(n int, exclude string) []Member {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var candidates []Member
+	for name, m := range g.members {
+		if name != g.cfg.Name && name != exclude && m.State == StateAlive {
+			candidates = append(candidates, m.Member)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+func (g *Gossip) expectAck() (uint64, chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.seq++
+	ack := make(chan struct{}, 1)
+	g.acks[g.seq] = ack
+	return g.seq, ack
+}
+
+func (g *Gossip) forget(seq uint64) {
+	g.mu.Lock()
+	delete(g.acks, seq)
+	g.mu.Unlock()
+}
+
+// send attaches pending updates to m and sends it.
+func (g *Gossip) send(to string, m *message) {
+	g.mu.Lock()
+	m.Updates = append(m.Updates, g.piggybackLocked()...)
+	g.mu.Unlock()
+
+	g.sendRaw(to, m)
+}
+
+func (g *Gossip) sendRaw(to string, m *message) {
+	if g.drop != nil && g.drop(to, m) {
+		return
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		g.error(err)
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp", to)
+	if err != nil {
+		g.error(err)
+		return
+	}
+	if _, err := g.conn.WriteToUDP(b, addr); err != nil {
+		select {
+		case <-g.stop:
+		default:
+			g.error(err)
+		}
+	}
+}
+
+func (g *Gossip) error(err error) {
+	if g.OnError != nil {
+		g.OnError(err)
+	}
+}
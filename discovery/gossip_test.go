@@ -0,0 +1,238 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig(name string, seeds ...string) GossipConfig {
+	return GossipConfig{
+		Name:           name,
+		BindAddr:       "127.0.0.1:0",
+		Seeds:          seeds,
+		ProbeInterval:  20 * time.Millisecond,
+		ProbeTimeout:   8 * time.Millisecond,
+		SuspectTimeout: 100 * time.Millisecond,
+	}
+}
+
+// startCluster starts n nodes on localhost, the first one being the seed
+func startCluster(t *testing.T, n int, hook func(i int, g *Gossip)) ([]*Gossip, []*fakeSetter) {
+	t.Helper()
+
+	var nodes []*Gossip
+	var setters []*fakeSetter
+	for i := 0; i < n; i++ {
+		var seeds []string
+		if i > 0 {
+			seeds = []string{nodes[0].Addr()}
+		}
+
+		setter := &fakeSetter{}
+		g, err := NewGossip(testConfig(fmt.Sprintf("http://node%d", i), seeds...), setter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hook != nil {
+			hook(i, g)
+		}
+		if err := g.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(g.Stop)
+
+		nodes = append(nodes, g)
+		setters = append(setters, setter)
+	}
+	return nodes, setters
+}
+
+func TestGossipJoin(t *testing.T) {
+	_, setters := startCluster(t, 3, nil)
+
+	want := []string{"http://node0", "http://node1", "http://node2"}
+	for i, s := range setters {
+		waitFor(t, func() bool {
+			got, _ := s.last()
+			return reflect.DeepEqual(got, want)
+		})
+		if got, _ := s.last(); !reflect.DeepEqual(got, want) {
+			t.Errorf("node%d peers = %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestGossipFailureDetection(t *testing.T) {
+	nodes, setters := startCluster(t, 3, nil)
+
+	all := []string{"http://node0", "http://node1", "http://node2"}
+	for _, s := range setters {
+		waitFor(t, func() bool {
+			got, _ := s.last()
+			return reflect.DeepEqual(got, all)
+		})
+	}
+
+	// 不通知其他节点 直接停止
+	nodes[2].Stop()
+
+	want := []string{"http://node0", "http://node1"}
+	for _, s := range setters[:2] {
+		waitFor(t, func() bool {
+			got, _ := s.last()
+			return reflect.DeepEqual(got, want)
+		})
+	}
+	for _, m := range nodes[0].Members() {
+		if m.Name == "http://node2" && m.State != StateDead {
+			t.Errorf("node2 state = %v; want dead", m.State)
+		}
+	}
+}
+
+func TestGossipReapsDead(t *testing.T) {
+	nodes, setters := startCluster(t, 3, func(i int, g *Gossip) {
+		g.cfg.DeadTimeout = 100 * time.Millisecond
+	})
+
+	all := []string{"http://node0", "http://node1", "http://node2"}
+	for _, s := range setters {
+		waitFor(t, func() bool {
+			got, _ := s.last()
+			return reflect.DeepEqual(got, all)
+		})
+	}
+
+	nodes[2].Stop()
+
+	// 先被判定为 dead 过了 DeadTimeout 之后被删除
+	var dead bool
+	waitFor(t, func() bool {
+		for _, m := range nodes[0].Members() {
+			if m.Name == "http://node2" {
+				if m.State == StateDead {
+					dead = true
+				}
+				return false
+			}
+		}
+		return true
+	})
+	if !dead {
+		t.Error("node2 removed without being seen dead first")
+	}
+	if got := len(nodes[0].Members()); got != 2 {
+		t.Errorf("node0 knows %d members; want 2", got)
+	}
+}
+
+func TestGossipLeave(t *testing.T) {
+	nodes, setters := startCluster(t, 3, nil)
+
+	all := []string{"http://node0", "http://node1", "http://node2"}
+	for _, s := range setters {
+		waitFor(t, func() bool {
+			got, _ := s.last()
+			return reflect.DeepEqual(got, all)
+		})
+	}
+
+	nodes[1].Leave()
+
+	want := []string{"http://node0", "http://node2"}
+	for _, s := range []*fakeSetter{setters[0], setters[2]} {
+		waitFor(t, func() bool {
+			got, _ := s.last()
+			return reflect.DeepEqual(got, want)
+		})
+	}
+}
+
+func TestGossipIndirectProbe(t *testing.T) {
+	var addrs [3]string
+	var pingReqs atomic.Int32
+	var cut atomic.Bool
+
+	// node0 和 node2 之间的直接链路断开 只能通过 node1 间接探测
+	nodes, setters := startCluster(t, 3, func(i int, g *Gossip) {
+		addrs[i] = g.Addr()
+		g.drop = func(to string, m *message) bool {
+			if m.Type == msgPingReq {
+				pingReqs.Add(1)
+			}
+			if !cut.Load() {
+				return false
+			}
+			return (i == 0 && to == addrs[2]) || (i == 2 && to == addrs[0])
+		}
+	})
+
+	all := []string{"http://node0", "http://node1", "http://node2"}
+	for _, s := range setters {
+		waitFor(t, func() bool {
+			got, _ := s.last()
+			return reflect.DeepEqual(got, all)
+		})
+	}
+
+	cut.Store(true)
+
+	// 远超 SuspectTimeout 之后 node2 仍然在 node0 的环上
+	time.Sleep(300 * time.Millisecond)
+	if got, _ := setters[0].last(); !reflect.DeepEqual(got, all) {
+		t.Errorf("node0 peers = %q; want %q", got, all)
+	}
+	for _, m := range nodes[0].Members() {
+		if m.State == StateDead {
+			t.Errorf("node0 sees %s as dead", m.Name)
+		}
+	}
+	if pingReqs.Load() == 0 {
+		t.Error("no indirect probes were sent")
+	}
+}
+
+func TestGossipNoSeed(t *testing.T) {
+	cfg := testConfig("http://lonely", "127.0.0.1:1")
+	g, err := NewGossip(cfg, &fakeSetter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(); err == nil {
+		g.Stop()
+		t.Fatal("Start succeeded without a reachable seed")
+	}
+}
+
+func TestSplitUpdates(t *testing.T) {
+	updates := make([]Member, 2000)
+	for i := range updates {
+		updates[i] = Member{Name: fmt.Sprintf("http://10.0.%d.%d:8000", i/256, i%256), Addr: fmt.Sprintf("10.0.%d.%d:7946", i/256, i%256), Incarnation: uint64(time.Now().UnixNano())}
+	}
+	parts := splitUpdates(updates)
+	if len(parts) < 2 {
+		t.Fatalf("%d members sent in %d packet", len(updates), len(parts))
+	}
+	var n int
+	for _, part := range parts {
+		b, err := json.Marshal(&message{Type: msgSyncAck, Seq: math.MaxUint64, Updates: part})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > maxPacketSize {
+			t.Errorf("sync ack of %d bytes; want at most %d", len(b), maxPacketSize)
+		}
+		n += len(part)
+	}
+	if n != len(updates) {
+		t.Errorf("parts hold %d members; want %d", n, len(updates))
+	}
+	if got := splitUpdates(nil); len(got) != 1 || len(got[0]) != 0 {
+		t.Errorf("splitUpdates(nil) = %v; want one empty part", got)
+	}
+}
@@ -0,0 +1,205 @@
+package groupcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	// EventGroupCreated: a group was created. Group is set.
+	EventGroupCreated EventType = iota + 1
+	// EventCacheHit: a Get was served from Cache.
+	EventCacheHit
+	// EventLoadStart: a Get missed and this process starts loading Key.
+	// Gets deduplicated by singleflight do not start a load.
+	EventLoadStart
+	// EventLoadFinish: a load finished after Duration. Peer is set if the
+	// value came from a peer; Err is set if the load failed.
+	EventLoadFinish
+	// EventEviction: Key was evicted from Cache to make room.
+	EventEviction
+	// EventPeerError: a request to Peer failed with Err.
+	EventPeerError
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventGroupCreated:
+		return "group_created"
+	case EventCacheHit:
+		return "cache_hit"
+	case EventLoadStart:
+		return "load_start"
+	case EventLoadFinish:
+		return "load_finish"
+	case EventEviction:
+		return "eviction"
+	case EventPeerError:
+		return "peer_error"
+	}
+	return "unknown"
+}
+
+// Event is something that happened in a group. Only the fields named in
+// the doc of its Type are set.
+type Event struct {
+	Type     EventType
+	Group    *Group
+	Key      string
+	Cache    CacheType
+	Peer     string
+	Err      error
+	Duration time.Duration
+}
+
+// eventBuffer is how many events a subscriber may fall behind before
+// new events are dropped.
+const eventBuffer = 256
+
+// Subscription is a subscriber of group events.
+type Subscription struct {
+	fn      func(Event)
+	types   map[EventType]bool // nil 表示所有类型
+	ch      chan Event
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+	bus     *eventBus
+}
+
+// Subscribe calls fn for every event of the given types, or of all types
+// if none are given, in every group of the default registry. Events are
+// delivered in order on a goroutine of the subscription, so a slow fn
+// never blocks a Get; while fn is more than a few hundred events behind,
+// new events are dropped and counted in Dropped.
+func Subscribe(fn func(Event), types ...EventType) *Subscription {
+	return defaultRegistry.Subscribe(fn, types...)
+}
+
+// Subscribe is like the package level Subscribe but receives the events
+// of the groups of r.
+func (r *Registry) Subscribe(fn func(Event), types ...EventType) *Subscription {
+	s := &Subscription{
+		bus:  &r.events,
+		fn:   fn,
+		ch:   make(chan Event, eventBuffer),
+		done: make(chan struct{}),
+	}
+	if len(types) > 0 {
+		s.types = make(map[EventType]bool)
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+	go s.run()
+	r.events.add(s)
+	return s
+}
+
+// Unsubscribe stops the delivery of events. Events already queued may
+// still be delivered.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.remove(s)
+		close(s.done)
+	})
+}
+
+// Dropped returns the number of events dropped because fn fell behind.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) run() {
+	for {
+		select {
+		case e := <-s.ch:
+			s.fn(e)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// eventBus fans the events of a registry out to its subscriptions.
+type eventBus struct {
+	mu   sync.Mutex
+	subs atomic.Pointer[[]*Subscription] // 发布时不加锁
+}
+
+func (b *eventBus) add(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var subs []*Subscription
+	if old := b.subs.Load(); old != nil {
+		subs = append(subs, *old...)
+	}
+	subs = append(subs, s)
+	b.subs.Store(&subs)
+}
+
+func (b *eventBus) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	old := b.subs.Load()
+	if old == nil {
+		return
+	}
+	var subs []*Subscription
+	for _, sub := range *old {
+		if sub != s {
+			subs = append(subs, sub)
+		}
+	}
+	b.subs.Store(&subs)
+}
+
+// active reports whether anyone subscribed, so callers can skip building
+// events nobody receives.
+func (b *eventBus) active() bool {
+	subs := b.subs.Load()
+	return subs != nil && len(*subs) > 0
+}
+
+func (b *eventBus) publish(e Event) {
+	subs := b.subs.Load()
+	if subs == nil {
+		return
+	}
+	for _, s := range *subs {
+		if s.types != nil && !s.types[e.Type] {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// emit publishes an event of the group.
+func (g *Group) emit(e Event) {
+	events := &g.reg().events
+	if !events.active() {
+		return
+	}
+	e.Group = g
+	events.publish(e)
+}
+
+// emitHit publishes a cache hit found by tracedLookup. Stale hits are
+// reported as MainCache hits.
+func (g *Group) emitHit(key, hit string) {
+	which := MainCache
+	if hit == hitHot {
+		which = HotCache
+	}
+	g.emit(Event{Type: EventCacheHit, Key: key, Cache: which})
+}
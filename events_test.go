@@ -0,0 +1,249 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// eventRecorder collects the events of one group.
+type eventRecorder struct {
+	group string
+	mu    sync.Mutex
+	got   []Event
+}
+
+func (r *eventRecorder) record(e Event) {
+	if e.Group == nil || e.Group.name != r.group {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.got = append(r.got, e)
+}
+
+// wait waits until n events arrived and returns them.
+func (r *eventRecorder) wait(t *testing.T, n int) []Event {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.Lock()
+		got := append([]Event(nil), r.got...)
+		r.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d events %v; want %d", len(got), got, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	reg := newTestRegistry(t)
+	all := &eventRecorder{group: "events"}
+	hits := &eventRecorder{group: "events"}
+	subAll := reg.Subscribe(all.record)
+	defer subAll.Unsubscribe()
+	subHits := reg.Subscribe(hits.record, EventCacheHit)
+	defer subHits.Unsubscribe()
+
+	g := reg.NewGroup("events", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), NoPeers{})
+	var s string
+	for i := 0; i < 2; i++ {
+		if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := all.wait(t, 4)
+	want := []EventType{EventGroupCreated, EventLoadStart, EventLoadFinish, EventCacheHit}
+	for i, typ := range want {
+		if got[i].Type != typ {
+			t.Fatalf("event %d = %v; want %v", i, got[i].Type, typ)
+		}
+	}
+	if e := got[2]; e.Key != "k" || e.Err != nil || e.Peer != "" || e.Duration <= 0 {
+		t.Errorf("load finish = %+v", e)
+	}
+	if e := hits.wait(t, 1)[0]; e.Key != "k" || e.Cache != MainCache {
+		t.Errorf("hit = %+v; want k in MainCache", e)
+	}
+}
+
+func TestGetMultiLoadEvents(t *testing.T) {
+	reg := newTestRegistry(t)
+	rec := &eventRecorder{group: "events-get-multi"}
+	sub := reg.Subscribe(rec.record, EventLoadStart, EventLoadFinish, EventPeerError)
+	defer sub.Unsubscribe()
+
+	g := reg.NewGroup("events-get-multi", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), keyPicker{prefix: "r-", peer: failingPeer{}})
+	if _, err := getMultiStrings(g, []string{"a", "r-b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	starts := make(map[string]int)
+	finishes := make(map[string]Event)
+	for _, e := range rec.wait(t, 5) {
+		switch e.Type {
+		case EventLoadStart:
+			starts[e.Key]++
+		case EventLoadFinish:
+			finishes[e.Key] = e
+		}
+	}
+	for _, key := range []string{"a", "r-b"} {
+		if starts[key] != 1 {
+			t.Errorf("%d LoadStart events for %s; want 1", starts[key], key)
+		}
+		// 远程失败后本地加载成功
+		if e, ok := finishes[key]; !ok || e.Err != nil || e.Peer != "" {
+			t.Errorf("LoadFinish for %s = %+v, %v; want a local load", key, e, ok)
+		}
+	}
+}
+
+func TestPeerErrorAndEvictionEvents(t *testing.T) {
+	rec := &eventRecorder{group: "events-peer-error"}
+	sub := Subscribe(rec.record, EventPeerError, EventEviction)
+	defer sub.Unsubscribe()
+
+	g := newTestGroup("events-peer-error", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("0123456789")
+	}), keyPicker{peer: failingPeer{}})
+	g.cacheBytes = 15
+	var s string
+	for _, key := range []string{"a", "b"} {
+		if err := g.Get(context.TODO(), key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := rec.wait(t, 3)
+	if e := got[0]; e.Type != EventPeerError || e.Key != "a" || e.Err == nil || e.Peer != "other" {
+		t.Errorf("first event = %+v; want peer error for a", e)
+	}
+	var evicted bool
+	for _, e := range got {
+		if e.Type == EventEviction {
+			evicted = true
+			if e.Key != "a" || e.Cache != MainCache {
+				t.Errorf("eviction = %+v; want a from MainCache", e)
+			}
+		}
+	}
+	if !evicted {
+		t.Error("no eviction event")
+	}
+}
+
+// failingPeer fails every Get.
+type failingPeer struct{}
+
+func (failingPeer) Get(context.Context, *pb.GetRequest, *pb.GetResponse) error {
+	return errors.New("peer down")
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	slow := Subscribe(func(Event) { <-release }, EventCacheHit)
+	defer slow.Unsubscribe()
+	defer close(release)
+
+	g := newTestGroup("events-slow", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), NoPeers{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var s string
+		for i := 0; i < 2*eventBuffer; i++ {
+			g.Get(context.TODO(), "k", StringSink(&s))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get blocked on a slow subscriber")
+	}
+	if slow.Dropped() == 0 {
+		t.Error("no events dropped for a subscriber that never returns")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	rec := &eventRecorder{group: "events-unsubscribe"}
+	sub := Subscribe(rec.record)
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+
+	g := newTestGroup("events-unsubscribe", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("boom")
+	}), NoPeers{})
+	g.emit(Event{Type: EventLoadStart})
+	time.Sleep(10 * time.Millisecond)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.got) != 0 {
+		t.Errorf("got %d events after Unsubscribe", len(rec.got))
+	}
+}
+
+func TestNewGroupHooks(t *testing.T) {
+	reg := newTestRegistry(t)
+	var got []string
+	for i := 0; i < 2; i++ {
+		reg.RegisterNewGroupHook(func(g *Group) {
+			if g.name == "events-hooks" {
+				got = append(got, g.name)
+			}
+		})
+	}
+	reg.NewGroup("events-hooks", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return nil
+	}), NoPeers{})
+	if len(got) != 2 {
+		t.Errorf("hooks ran %d times; want 2", len(got))
+	}
+}
+
+func TestRegistrySubscribe(t *testing.T) {
+	a, b := newTestRegistry(t), newTestRegistry(t)
+	recA := &eventRecorder{group: "g"}
+	subA := a.Subscribe(recA.record, EventGroupCreated)
+	defer subA.Unsubscribe()
+	recDefault := &eventRecorder{group: "g"}
+	subDefault := Subscribe(recDefault.record, EventGroupCreated)
+	defer subDefault.Unsubscribe()
+
+	getter := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	})
+	b.NewGroup("g", 1<<20, getter, NoPeers{})
+	ga := a.NewGroup("g", 1<<20, getter, NoPeers{})
+
+	if got := recA.wait(t, 1); got[0].Group != ga {
+		t.Errorf("registry subscriber got an event of another registry's group")
+	}
+	time.Sleep(10 * time.Millisecond)
+	recA.mu.Lock()
+	defer recA.mu.Unlock()
+	if len(recA.got) != 1 {
+		t.Errorf("registry subscriber got %d events; want 1", len(recA.got))
+	}
+	recDefault.mu.Lock()
+	defer recDefault.mu.Unlock()
+	if len(recDefault.got) != 0 {
+		t.Errorf("default registry subscriber got %d events of other registries", len(recDefault.got))
+	}
+}
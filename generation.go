@@ -0,0 +1,150 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// cacheKey is the key of a cache entry: the user's key plus the
+// generation of the group it was loaded in. Bumping the generation makes
+// every older entry unreachable; the eviction policy drops them in time.
+type cacheKey struct {
+	key string
+	gen uint64
+}
+
+// cacheKey returns the key of key in the current generation.
+func (g *Group) cacheKey(key string) cacheKey {
+	return cacheKey{key: key, gen: g.Generation()}
+}
+
+// flightKey is the singleflight key, so a load of an old generation is
+// never shared with a Get of the new one.
+func (k cacheKey) flightKey() string {
+	return strconv.FormatUint(k.gen, 10) + ":" + k.key
+}
+
+// GenerationSetter is optionally implemented by a ProtoGetter whose peer
+// accepts generation updates, needed by Group.BumpGeneration.
+type GenerationSetter interface {
+	// SetGeneration raises the peer's generation of group to gen.
+	// A peer never lowers its generation.
+	SetGeneration(ctx context.Context, group string, gen uint64) error
+}
+
+var errNoGeneration = errors.New("groupcache: peer does not accept generations")
+
+// Generation returns the group's current generation.
+func (g *Group) Generation() uint64 {
+	return g.generation.Load()
+}
+
+// BumpGeneration invalidates every entry of the group at once by moving
+// to a new generation, and tells every peer about it. Nothing is removed
+// eagerly: entries of older generations are no longer looked up and are
+// evicted by the cache policy like any other cold entry.
+//
+// Peers that could not be reached still learn the new generation from
+// the next request between them and this process.
+func (g *Group) BumpGeneration(ctx context.Context) (uint64, error) {
+	g.peersOnce.Do(g.initPeers)
+
+	gen := g.generation.Add(1)
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return gen, nil
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for _, peer := range lister.GetAll() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := errNoGeneration
+			if s, ok := peer.(GenerationSetter); ok {
+				err = s.SetGeneration(ctx, g.name, gen)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return gen, errors.Join(errs...)
+}
+
+// observeGeneration moves the group to gen if gen is newer.
+// 两个节点同时 Bump 时取较大的值 两次 Bump 合并成一次
+func (g *Group) observeGeneration(gen uint64) {
+	for {
+		cur := g.generation.Load()
+		if gen <= cur || g.generation.CompareAndSwap(cur, gen) {
+			return
+		}
+	}
+}
+
+// The generation travels with GetRequest and GetResponse as field 15,
+// which groupcachepb does not define; old peers keep it as an unknown
+// field and ignore it.
+//
+//	message GetRequest {
+//	  ...
+//	  uint64 generation = 15;
+//	}
+//	message GetResponse {
+//	  ...
+//	  uint64 generation = 15;
+//	}
+const generationField = 15
+
+// appendGeneration appends the generation field to the unknown fields
+// of a message. Generation 0 is not sent.
+func appendGeneration(b []byte, gen uint64) []byte {
+	if gen == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, generationField, protowire.VarintType)
+	return protowire.AppendVarint(b, gen)
+}
+
+// generationOf returns the generation field of a message's unknown
+// fields, or 0 if there is none.
+func generationOf(b []byte) uint64 {
+	gen, _ := varintField(b, generationField)
+	return gen
+}
+
+// varintField returns the last varint field num of an encoded message.
+func varintField(b []byte, num protowire.Number) (v uint64, ok bool) {
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return
+		}
+		b = b[l:]
+		if n == num && typ == protowire.VarintType {
+			x, l := protowire.ConsumeVarint(b)
+			if l < 0 {
+				return
+			}
+			v, ok = x, true
+			b = b[l:]
+			continue
+		}
+		l = protowire.ConsumeFieldValue(n, typ, b)
+		if l < 0 {
+			return
+		}
+		b = b[l:]
+	}
+	return
+}
@@ -0,0 +1,143 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestBumpGenerationLocal(t *testing.T) {
+	var loads atomic.Int32
+	g := newTestGroup("generation-local", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key + strconv.Itoa(int(loads.Add(1))))
+	}), NoPeers{})
+	ctx := context.TODO()
+
+	var s string
+	for i := 0; i < 2; i++ {
+		if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "k1" {
+			t.Fatalf("Get = %q, %v; want %q", s, err, "k1")
+		}
+	}
+
+	gen, err := g.BumpGeneration(ctx)
+	if err != nil || gen != 1 {
+		t.Fatalf("BumpGeneration = %d, %v; want 1", gen, err)
+	}
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "k2" {
+		t.Fatalf("Get after bump = %q, %v; want %q", s, err, "k2")
+	}
+
+	// 旧的代没有被立即删除 由淘汰策略处理
+	if n := g.mainCache.items(); n != 2 {
+		t.Errorf("mainCache has %d items; want 2", n)
+	}
+}
+
+func TestObserveGenerationNeverLowers(t *testing.T) {
+	g := &Group{}
+	g.observeGeneration(3)
+	g.observeGeneration(2)
+	if gen := g.Generation(); gen != 3 {
+		t.Errorf("Generation = %d; want 3", gen)
+	}
+}
+
+func TestGenerationWireFormat(t *testing.T) {
+	in := &pb.GetResponse{
+		Value:            []byte("x"),
+		XXX_unrecognized: appendGeneration(nil, 300),
+	}
+	b, err := proto.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &pb.GetResponse{}
+	if err := proto.Unmarshal(b, out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Value) != "x" || generationOf(out.XXX_unrecognized) != 300 {
+		t.Errorf("decoded %q gen %d; want %q gen 300", out.Value, generationOf(out.XXX_unrecognized), "x")
+	}
+	if appendGeneration(nil, 0) != nil || generationOf(nil) != 0 {
+		t.Error("generation 0 should not be encoded")
+	}
+}
+
+func TestGenerationHTTPPeer(t *testing.T) {
+	const name = "generation-http"
+	reg := newTestRegistry(t)
+
+	owner := reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner")
+	}), NoPeers{})
+
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: reg}))
+	defer ts.Close()
+	pool := newHTTPPool("http://self", nil)
+	pool.Set(ts.URL)
+
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), pool)
+	testGenerationPeer(t, g, owner)
+}
+
+func TestGenerationGRPCPeer(t *testing.T) {
+	const name = "generation-grpc"
+	reg := newTestRegistry(t)
+
+	owner := reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner")
+	}), NoPeers{})
+
+	lis := startBufconnServer(t, newGRPCPool("owner", &GRPCPoolOptions{Registry: reg}))
+	pool := newGRPCPool("self", &GRPCPoolOptions{DialOptions: bufconnDialOptions(lis)})
+	defer pool.Close()
+	pool.Set("passthrough:///owner")
+
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), pool)
+	testGenerationPeer(t, g, owner)
+}
+
+// testGenerationPeer checks that g, whose only peer is owner, shares its
+// generation with owner in both directions.
+func testGenerationPeer(t *testing.T, g, owner *Group) {
+	t.Helper()
+	ctx := context.TODO()
+
+	if _, err := g.BumpGeneration(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if gen := owner.Generation(); gen != 1 {
+		t.Fatalf("owner generation after bump = %d; want 1", gen)
+	}
+
+	// 对端的代随响应带回
+	if _, err := owner.BumpGeneration(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := g.Get(ctx, "a", StringSink(&s)); err != nil || s != "owner" {
+		t.Fatalf("Get = %q, %v; want %q", s, err, "owner")
+	}
+	if gen := g.Generation(); gen != 2 {
+		t.Errorf("generation learned from response = %d; want 2", gen)
+	}
+
+	// 本地的代随请求发给对端
+	g.observeGeneration(5)
+	if err := g.Get(ctx, "b", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if gen := owner.Generation(); gen != 5 {
+		t.Errorf("generation learned from request = %d; want 5", gen)
+	}
+}
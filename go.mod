@@ -4,10 +4,16 @@ go 1.25.4
 
 require (
 	github.com/golang/groupcache v0.0.0-20241129210726-2c02b8208cf8
-	golang.org/x/sync v0.18.0 // direct
+	github.com/golang/protobuf v1.5.4
+	golang.org/x/sync v0.22.0 // direct
+	google.golang.org/grpc v1.84.0
 )
 
+require google.golang.org/protobuf v1.36.11
+
 require (
-	github.com/golang/protobuf v1.5.4 // indirect
-	google.golang.org/protobuf v1.33.0 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
 )
@@ -7,9 +7,10 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	cachepolicy "example.com/gcache/cache_policy"
-	"example.com/gcache/singleflight"
+	pb "github.com/golang/groupcache/groupcachepb"
 )
 
 type Getter interface {
@@ -23,77 +24,32 @@ func (f GetterFunc) Get(ctx context.Context, key string, dest Sink) error {
 	return f(ctx, key, dest)
 }
 
-var (
-	mu 					sync.RWMutex
-	groups = make(map[string]*Group)
-
-	initPeerServerOnce 	sync.Once
-	initPeerServer 		func()
-)
-
+// GetGroup returns the group of the default registry named name.
 func GetGroup(name string) *Group {
-	mu.RLock()
-	g := groups[name]
-	mu.RUnlock()
-	return g
+	return defaultRegistry.GetGroup(name)
 }
 
+// NewGroup creates a group in the default registry.
 func NewGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *Group {
-	return newGroup(name, cacheBytes, getter, nil)
-}
-
-func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *Group {
-	if getter == nil {
-		panic("nil Getter")
-	}
-
-	mu.Lock()
-	defer mu.Unlock()
-
-	// 初始化对等节点服务
-	initPeerServerOnce.Do(callInitPeerServer)
-
-	if _, dup := groups[name]; dup {
-		panic("duplicate registration of group " + name)
-	}
-
-	g := &Group {
-		name: name,
-		getter: getter,
-		peers: peers,
-		cacheBytes: cacheBytes,
-		loadGroup: &singleflight.Group{},
-	}
-
-	if fn := newGroupHook; fn != nil {
-		fn(g)
-	}
-
-	groups[name] = g
-	return g
+	return defaultRegistry.NewGroup(name, cacheBytes, getter, peers)
 }
 
-// Hook Function 拓展功能
-var newGroupHook func(*Group)
-
+// RegisterNewGroupHook registers fn to be called synchronously with every
+// new group of the default registry before NewGroup returns it. It may be
+// called more than once.
+//
+// Deprecated: use Subscribe with EventGroupCreated. The hook is kept
+// for code that must configure a group before its first Get.
 func RegisterNewGroupHook(fn func(*Group)) {
-	if newGroupHook != nil {
-		panic("RegisterNewGroupHook called more than once")
-	}
-	newGroupHook = fn
+	defaultRegistry.RegisterNewGroupHook(fn)
 }
 
+// RegisterServeStart registers fn to be called once, when the first group
+// of the default registry is created.
+//
+// Deprecated: use Subscribe with EventGroupCreated.
 func RegisterServeStart(fn func()) {
-	if initPeerServer != nil {
-		panic("RegisterServerStart called more than once")
-	}
-	initPeerServer = fn
-}
-
-func callInitPeerServer() {
-	if initPeerServer != nil {
-		initPeerServer()
-	}
+	defaultRegistry.RegisterServeStart(fn)
 }
 
 type Group struct {
@@ -103,31 +59,112 @@ type Group struct {
 	peers 		PeerPicker
 	cacheBytes 	int64
 
-	mainCache 	cachepolicy.LRUCache
-	hotCache	cachepolicy.LRUCache
-
-	loadGroup 	flightGroup
+	// 本节点负责的 key
+	mainCache 	cache
+	// 其他节点负责但访问频繁的 key
+	hotCache	cache
+	// 不存在的 key 见 SetNotFoundTTL
+	missCache	cache
+
+	loadGroup 	FlightGroup
+	// Set 和 Remove 用来阻止正在进行的加载写回旧值
+	inval 		invalidations
+	// 缓存 key 的代 见 BumpGeneration
+	generation 	atomic.Uint64
+	refresh 	RefreshOptions
+	notFoundTTL time.Duration
+	// 每个 key 的访问频率 决定哪些值放进 hotCache
+	hot 		hotKeys
+	tracer 		Tracer
+	// 拥有者主动推送热点 key 见 SetReplicationOptions
+	replicas 	replicator
+	// 正在后台刷新的 cacheKey
+	refreshing 	sync.Map
+	// 后台刷新和热点推送 Close 时停止
+	bg 			background
+	closed 		atomic.Bool
+	registry 	*Registry
+	// hotCache 最多占 mainCache 的比例 为零时是八分之一
+	hotFraction float64
+	clock 		Clock
+	// 非空时压缩大的值 见 WithCompression
+	compression *CompressionOptions
 
 	_ int32
 
 	Stats Stats
+	// 非空时代替全局随机数 见 WithRandSeed
+	randMu sync.Mutex
 	rand *rand.Rand
 }
 
-type flightGroup interface {
+// FlightGroup deduplicates concurrent loads of the same key, like
+// singleflight.Group. If it also has a Forget(key string) method, Remove
+// and Set use it so later Gets do not wait for a load that is out of date.
+type FlightGroup interface {
 	Do(key string, fn func() (interface{}, error)) (interface{}, error)
 }
 
 type Stats struct {
-	Gets           AtomicInt // 总请求数
-	CacheHits      AtomicInt // 缓存命中数（Main 或 Hot）
-	PeerLoads      AtomicInt // 成功从远程节点获取的次数
-	PeerErrors     AtomicInt // 远程获取失败次数
-	Loads          AtomicInt // 需要加载（没命中）的总次数
-	LoadsDeduped   AtomicInt // 经 singleflight 去重后实际执行的加载次数
-	LocalLoads     AtomicInt // 本地回源（调用 Getter）次数
-	LocalLoadErrs  AtomicInt // 本地回源失败次数
-	ServerRequests AtomicInt // 收到来自其他节点的请求数
+	Gets                  AtomicInt // 总请求数
+	CacheHits             AtomicInt // 缓存命中数（Main 或 Hot）
+	PeerLoads             AtomicInt // 成功从远程节点获取的次数
+	PeerErrors            AtomicInt // 远程获取失败次数
+	Loads                 AtomicInt // 需要加载（没命中）的总次数
+	LoadsDeduped          AtomicInt // 经 singleflight 去重后实际执行的加载次数
+	LocalLoads            AtomicInt // 本地回源（调用 Getter）次数
+	LocalLoadErrs         AtomicInt // 本地回源失败次数
+	ServerRequests        AtomicInt // 收到来自其他节点的请求数
+	StaleHits             AtomicInt // 过期但仍在宽限期内返回的次数
+	BackgroundRefreshes   AtomicInt // 后台刷新次数
+	BackgroundRefreshErrs AtomicInt // 后台刷新失败次数
+	NotFoundLoads         AtomicInt // 加载结果为 ErrNotFound 的次数
+	NotFoundHits          AtomicInt // 命中不存在缓存的次数
+	HotPushes             AtomicInt // 主动推送热点 key 的次数
+	HotPushErrs           AtomicInt // 推送到某个节点失败的次数
+
+	GetLatency       Histogram // Group.Get 的总耗时
+	LocalLoadLatency Histogram // 调用 Getter 的耗时
+	PeerLoadLatency  Histogram // 调用 ProtoGetter.Get 的耗时
+	peerLatency      peerHistograms
+}
+
+// CacheType represents a type of cache.
+type CacheType int
+
+const (
+	// MainCache is the cache for items that this peer is the owner for.
+	MainCache CacheType = iota + 1
+
+	// HotCache is the cache for items that seem popular enough to
+	// replicate to this node, even though it's not the owner.
+	HotCache
+
+	// MissCache is the cache of keys known not to exist.
+	MissCache
+)
+
+// CacheStats are returned by stats accessors on Group.
+type CacheStats struct {
+	Bytes     int64
+	Items     int64
+	Gets      int64
+	Hits      int64
+	Evictions int64 // 因为容量不足被淘汰 不含删除和过期
+}
+
+// CacheStats returns stats about the provided cache within the group.
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	case MissCache:
+		return g.missCache.stats()
+	default:
+		return CacheStats{}
+	}
 }
 
 func (g *Group) Name() string {
@@ -136,34 +173,547 @@ func (g *Group) Name() string {
 
 func (g *Group) initPeers() {
 	if g.peers == nil {
-		g.peers = getPeers(g.name)
+		g.peers = g.reg().getPeers(g.name)
 	}
 }
 
 func (g *Group) Get(ctx context.Context, key string, dest Sink) error {
+	return g.get(ctx, key, dest, false)
+}
+
+// peerGet is Get for a request from a peer. A value cached compressed
+// is returned compressed, so it is sent without compressing it again.
+func (g *Group) peerGet(ctx context.Context, key string) (ByteView, error) {
+	var view ByteView
+	err := g.get(ctx, key, ByteViewSink(&view), true)
+	return view, err
+}
+
+// get is Get. If raw is set, cache hits are put into dest as they are
+// cached, possibly compressed; dest must then be a ByteViewSink.
+func (g *Group) get(ctx context.Context, key string, dest Sink, raw bool) (err error) {
 	g.peersOnce.Do(g.initPeers)
 	g.Stats.Gets.Add(1)
+	ctx, span := g.startSpan(ctx, SpanGet)
+	defer func(start time.Time) {
+		g.Stats.GetLatency.Observe(g.since(start))
+		span.End(err)
+	}(g.now())
 
 	if dest == nil {
 		return errors.New("Groupcache: nil dest Sink")
 	}
+	if g.closed.Load() {
+		return ErrGroupClosed
+	}
 
-	value, cacheHit := g.lookupCache(key)
+	g.hot.hit(key, g.now())
+	ck := g.cacheKey(key)
+	value, hit := g.tracedLookup(ctx, ck)
+	span.SetAttribute(AttrHit, hit)
 
-	if cacheHit {
+	if hit != hitMiss && hit != hitNotFound && !raw {
+		// 解压失败当作没有命中 重新加载
+		if value, err = g.decompress(value); err != nil {
+			hit = hitMiss
+		}
+	}
+
+	switch hit {
+	case hitNotFound:
+		g.Stats.NotFoundHits.Add(1)
+		return ErrNotFound
+	case hitMain, hitHot, hitStale:
 		g.Stats.CacheHits.Add(1)
+		g.emitHit(key, hit)
+		g.maybeRefresh(ck, value)
+		span.SetAttribute(AttrBytes, value.Len())
 		return setSinkView(dest, value)
 	}
 
 	destPopulated := false
-	value, destPopulated, err := g.load(ctx, key, dest)
+	value, destPopulated, err = g.load(ctx, ck, dest, false)
 	if err != nil {
 		return err
 	}
+	span.SetAttribute(AttrBytes, value.Len())
 	if destPopulated {
+		// Getter 写入 dest 时还没有过期时间
+		setSinkExpire(dest, value.e)
 		return nil
 	}
 
 	return setSinkView(dest, value)
 }
 
+// Values of the AttrHit span attribute.
+const (
+	hitMain     = "main"
+	hitHot      = "hot"
+	hitStale    = "stale"
+	hitNotFound = "not_found"
+	hitMiss     = "miss"
+)
+
+// tracedLookup looks key up in the negative, main and hot caches and
+// reports where it was found.
+func (g *Group) tracedLookup(ctx context.Context, key cacheKey) (value ByteView, hit string) {
+	_, span := g.startSpan(ctx, SpanLookupCache)
+	defer func() {
+		span.SetAttribute(AttrHit, hit)
+		span.End(nil)
+	}()
+
+	if g.lookupNotFound(key) {
+		return ByteView{}, hitNotFound
+	}
+	value, which, ok := g.lookupRawIn(key)
+	switch {
+	case !ok:
+		return value, hitMiss
+	case value.expired(g.now()):
+		return value, hitStale
+	case which == HotCache:
+		return value, hitHot
+	}
+	return value, hitMain
+}
+
+// load loads key through the singleflight group. The result is cached
+// under ck, so a load that started before BumpGeneration does not
+// populate the new generation. A refresh load ignores the cached value.
+func (g *Group) load(ctx context.Context, ck cacheKey, dest Sink, refresh bool) (value ByteView, destPopulated bool, err error) {
+	g.Stats.Loads.Add(1)
+	key := ck.key
+	ctx, span := g.startSpan(ctx, SpanSingleflight)
+	leader := false
+	var loadStart time.Time
+	var loadPeer string
+	defer func() {
+		span.SetAttribute(AttrDeduped, !leader)
+		span.End(err)
+	}()
+	viewi, err := g.loadGroup.Do(ck.flightKey(), func() (interface{}, error) {
+		leader = true
+		// 排队等待 singleflight 期间 其他调用可能已经填充了缓存
+		if !refresh && g.lookupNotFound(ck) {
+			g.Stats.NotFoundHits.Add(1)
+			return nil, ErrNotFound
+		}
+		if value, cacheHit := g.lookupCache(ck); cacheHit && !refresh && !value.expired(g.now()) {
+			g.Stats.CacheHits.Add(1)
+			return value, nil
+		}
+		g.Stats.LoadsDeduped.Add(1)
+		loadStart = g.now()
+		g.emit(Event{Type: EventLoadStart, Key: key})
+
+		start := g.inval.begin()
+		defer g.inval.end()
+
+		var value ByteView
+		var err error
+		if peer, ok := g.pickPeer(ctx, key); ok {
+			value, err = g.getFromPeer(ctx, peer, key)
+			var plain ByteView
+			if err == nil {
+				// 压缩的值原样放进 hotCache 交给调用方之前再解压
+				value = g.withTTL(value)
+				plain, err = g.decompress(value)
+			}
+			if err == nil {
+				g.Stats.PeerLoads.Add(1)
+				loadPeer = peerName(peer)
+				g.maybePopulateHotCache(ck, start, value)
+				return plain, nil
+			}
+			// 拥有者说不存在 不再本地加载
+			var nf *notFoundError
+			if errors.As(err, &nf) {
+				g.Stats.NotFoundLoads.Add(1)
+				if !nf.expire.IsZero() {
+					g.inval.populate(key, start, func() {
+						g.populateCache(ck, ByteView{e: nf.expire}, &g.missCache)
+					})
+				}
+				return nil, ErrNotFound
+			}
+			g.Stats.PeerErrors.Add(1)
+			g.emit(Event{Type: EventPeerError, Key: key, Peer: peerName(peer), Err: err})
+			// 远程失败 退回到本地加载
+		}
+
+		value, err = g.getLocally(ctx, key, dest)
+		if errors.Is(err, ErrNotFound) {
+			g.Stats.NotFoundLoads.Add(1)
+			if g.notFoundTTL > 0 {
+				expire := g.now().Add(g.notFoundTTL)
+				g.inval.populate(key, start, func() {
+					g.populateCache(ck, ByteView{e: expire}, &g.missCache)
+				})
+			}
+			return nil, err
+		}
+		if err != nil {
+			g.Stats.LocalLoadErrs.Add(1)
+			return nil, err
+		}
+		g.Stats.LocalLoads.Add(1)
+		destPopulated = true // only one caller of load gets this return value
+		value = g.withTTL(value)
+		g.populateSince(start, ck, value, &g.mainCache)
+		return value, nil
+	})
+
+	if !loadStart.IsZero() {
+		g.emit(Event{Type: EventLoadFinish, Key: key, Peer: loadPeer, Err: err, Duration: g.since(loadStart)})
+	}
+	if err == nil {
+		value = viewi.(ByteView)
+	}
+	return
+}
+
+// pickPeer is PeerPicker.PickPeer in a span.
+func (g *Group) pickPeer(ctx context.Context, key string) (ProtoGetter, bool) {
+	_, span := g.startSpan(ctx, SpanPickPeer)
+	peer, ok := g.peers.PickPeer(key)
+	if ok {
+		span.SetAttribute(AttrPeer, peerName(peer))
+	}
+	span.End(nil)
+	return peer, ok
+}
+
+func (g *Group) getLocally(ctx context.Context, key string, dest Sink) (value ByteView, err error) {
+	ctx, span := g.startSpan(ctx, SpanGetLocally)
+	defer func() {
+		span.SetAttribute(AttrBytes, value.Len())
+		span.End(err)
+	}()
+
+	start := g.now()
+	err = g.getter.Get(ctx, key, dest)
+	g.Stats.LocalLoadLatency.Observe(g.since(start))
+	if err != nil {
+		return ByteView{}, err
+	}
+	return dest.view()
+}
+
+func (g *Group) getFromPeer(ctx context.Context, peer ProtoGetter, key string) (value ByteView, err error) {
+	ctx, span := g.startSpan(ctx, SpanPeerGet)
+	span.SetAttribute(AttrPeer, peerName(peer))
+	defer func() {
+		span.SetAttribute(AttrBytes, value.Len())
+		span.End(err)
+	}()
+	ctx = g.injectTrace(ctx)
+
+	req := &pb.GetRequest{
+		Group:            &g.name,
+		Key:              &key,
+		XXX_unrecognized: g.acceptCompression(appendGeneration(nil, g.Generation())),
+	}
+	res := &pb.GetResponse{}
+	start := g.now()
+	err = peer.Get(ctx, req, res)
+	d := g.since(start)
+	g.Stats.PeerLoadLatency.Observe(d)
+	g.Stats.peerLatency.observe(peerName(peer), d)
+	if err != nil {
+		return ByteView{}, err
+	}
+	g.observeGeneration(generationOf(res.XXX_unrecognized))
+	if err := notFoundOf(res); err != nil {
+		return ByteView{}, err
+	}
+
+	value, err = g.responseValue(res)
+	value.e = expireOf(res.XXX_unrecognized)
+	return value, err
+}
+
+// maybePopulateHotCache keeps a value fetched from a peer locally
+// if its key is hot and was not invalidated since start.
+func (g *Group) maybePopulateHotCache(key cacheKey, start uint64, value ByteView) {
+	var pop bool
+	if g.hot.disabled() {
+		// 不统计访问频率时 十分之一的概率放入 hotCache
+		pop = g.intn(10) == 0
+	} else {
+		pop = g.hot.isHot(key.key, g.now())
+	}
+	if pop {
+		g.populateSince(start, key, value, &g.hotCache)
+	}
+}
+
+// lookupCache also returns values that expired less than StaleFor ago.
+func (g *Group) lookupCache(key cacheKey) (value ByteView, ok bool) {
+	value, _, ok = g.lookupCacheIn(key)
+	return
+}
+
+// lookupCacheIn is lookupCache that also reports which cache had the value.
+func (g *Group) lookupCacheIn(key cacheKey) (value ByteView, which CacheType, ok bool) {
+	value, which, ok = g.lookupRawIn(key)
+	if !ok {
+		return
+	}
+	// 解压失败当作没有命中 重新加载
+	if value, err := g.decompress(value); err == nil {
+		return value, which, true
+	}
+	return ByteView{}, which, false
+}
+
+// lookupRawIn is lookupCacheIn without decompressing the value.
+func (g *Group) lookupRawIn(key cacheKey) (value ByteView, which CacheType, ok bool) {
+	if g.cacheBytes <= 0 {
+		return
+	}
+
+	// 过期不到 StaleFor 的值仍然返回
+	now := g.now().Add(-g.refresh.StaleFor)
+	which = MainCache
+	value, ok = g.mainCache.getAt(key, now)
+	if !ok {
+		which = HotCache
+		value, ok = g.hotCache.getAt(key, now)
+	}
+	return
+}
+
+// populateSince compresses value and puts it into cache unless key was
+// invalidated since start.
+func (g *Group) populateSince(start uint64, key cacheKey, value ByteView, cache *cache) {
+	// 压缩比较慢 不要在 inval 的锁里做
+	value = g.compress(value)
+	g.inval.populate(key.key, start, func() {
+		g.populateCache(key, value, cache)
+	})
+}
+
+// populateCache puts value, already compressed by the caller, into cache.
+func (g *Group) populateCache(key cacheKey, value ByteView, cache *cache) {
+	// 关闭后完成的加载不再写入缓存
+	if g.cacheBytes <= 0 || g.closed.Load() {
+		return
+	}
+	cache.add(key, value)
+
+	// Evict items from cache(s) if necessary.
+	for {
+		mainBytes := g.mainCache.bytes()
+		hotBytes := g.hotCache.bytes()
+		missBytes := g.missCache.bytes()
+		if mainBytes+hotBytes+missBytes <= g.cacheBytes {
+			return
+		}
+
+		// missCache 最多占 mainCache 的八分之一 hotCache 见 hotLimit
+		victim, which := &g.mainCache, MainCache
+		if missBytes > mainBytes/8 {
+			victim, which = &g.missCache, MissCache
+		} else if hotBytes > g.hotLimit(mainBytes) {
+			victim, which = &g.hotCache, HotCache
+		}
+		if key, ok := victim.removeOldest(); ok {
+			g.emit(Event{Type: EventEviction, Key: key, Cache: which})
+		}
+	}
+}
+
+// cache wraps a cache policy with a mutex and byte accounting.
+type cache struct {
+	mu       sync.RWMutex
+	nbytes   int64 // of all keys and values
+	nget     int64
+	nhit     int64
+	nevict   int64 // 因为容量不足被淘汰的条目数
+	dropping bool  // 删除和过期不算淘汰
+	evicted  string // 最近一次淘汰的 key
+	lru      cachepolicy.Policy
+	// 为空时使用 LRU
+	policy   EvictionPolicy
+	// 为空时使用系统时间
+	clock    Clock
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var items int64
+	if c.lru != nil {
+		items = int64(c.lru.Len())
+	}
+	return CacheStats{
+		Bytes:     c.nbytes,
+		Items:     items,
+		Gets:      c.nget,
+		Hits:      c.nhit,
+		Evictions: c.nevict,
+	}
+}
+
+func (c *cache) add(key cacheKey, value ByteView) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		policy := c.policy
+		if policy == nil {
+			policy = LRU
+		}
+		c.lru = policy(func(key cachepolicy.Key, value interface{}) {
+			c.onEvicted(key.(cacheKey), value.(ByteView))
+		})
+		if vp, ok := c.lru.(viewPolicy); ok {
+			vp.setViewEvicted(c.onViewEvicted)
+		}
+	}
+	// 替换旧值时先删除 保证字节数正确
+	c.drop(key)
+	if vp, ok := c.lru.(viewPolicy); ok {
+		vp.addView(key, value)
+	} else {
+		c.lru.Add(key, value)
+	}
+	c.nbytes += int64(len(key.key)) + int64(value.Len())
+}
+
+// onEvicted accounts for an entry the policy removed. c.mu is held.
+func (c *cache) onEvicted(key cacheKey, value ByteView) {
+	c.nbytes -= int64(len(key.key)) + int64(value.Len())
+	if !c.dropping {
+		c.nevict++
+		c.evicted = key.key
+	}
+}
+
+// onViewEvicted is onEvicted for a viewPolicy. Only an eviction copies
+// the key; a removal does not.
+func (c *cache) onViewEvicted(key []byte, _ uint64, value ByteView) {
+	c.nbytes -= int64(len(key)) + int64(value.Len())
+	if !c.dropping {
+		c.nevict++
+		c.evicted = string(key)
+	}
+}
+
+// get is getAt at the time of the cache's clock.
+func (c *cache) get(key cacheKey) (value ByteView, ok bool) {
+	return c.getAt(key, c.now())
+}
+
+func (c *cache) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+// getAt is like get but treats now as the current time, so a value
+// stays readable until now passes its expiry.
+func (c *cache) getAt(key cacheKey, now time.Time) (value ByteView, ok bool) {
+	// LRU 的 Get 会移动链表 所以这里也要用写锁
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nget++
+	if c.lru == nil {
+		return
+	}
+	if vp, isView := c.lru.(viewPolicy); isView {
+		value, ok = vp.getView(key)
+	} else {
+		var vi interface{}
+		if vi, ok = c.lru.Get(key); ok {
+			value = vi.(ByteView)
+		}
+	}
+	if !ok {
+		return
+	}
+	// 过期的值在读取时删除
+	if value.expired(now) {
+		c.drop(key)
+		return ByteView{}, false
+	}
+	c.nhit++
+	return value, true
+}
+
+func (c *cache) remove(key cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru != nil {
+		c.drop(key)
+	}
+}
+
+// drop removes key without counting an eviction. c.mu is held.
+func (c *cache) drop(key cacheKey) {
+	c.dropping = true
+	if vp, ok := c.lru.(viewPolicy); ok {
+		vp.removeView(key)
+	} else {
+		c.lru.Remove(key)
+	}
+	c.dropping = false
+}
+
+// clear drops every entry without counting evictions.
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru = nil
+	c.nbytes = 0
+}
+
+// removeOldest evicts the least recently used entry and returns its key.
+func (c *cache) removeOldest() (key string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil || c.lru.Len() == 0 {
+		return "", false
+	}
+	c.lru.RemoveOldest()
+	return c.evicted, true
+}
+
+func (c *cache) bytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nbytes
+}
+
+func (c *cache) items() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.lru == nil {
+		return 0
+	}
+	return int64(c.lru.Len())
+}
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
@@ -0,0 +1,39 @@
+package groupcache
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCacheStats(t *testing.T) {
+	g := newTestGroup("cache-stats", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(strings.Repeat("x", 20))
+	}), NoPeers{})
+	g.cacheBytes = 50 // 两个条目
+	ctx := context.TODO()
+
+	var s string
+	for _, key := range []string{"a", "b", "c", "a", "a"} {
+		if err := g.Get(ctx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 每次未命中查两次 main 缓存 加载前一次 singleflight 里一次
+	want := CacheStats{Bytes: 42, Items: 2, Gets: 9, Hits: 1, Evictions: 2}
+	if got := g.CacheStats(MainCache); got != want {
+		t.Errorf("main CacheStats = %+v; want %+v", got, want)
+	}
+
+	// 删除不算淘汰
+	if err := g.Remove(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	got := g.CacheStats(MainCache)
+	if got.Items != 1 || got.Bytes != 21 || got.Evictions != 2 {
+		t.Errorf("main CacheStats after Remove = %+v", got)
+	}
+	if got := g.CacheStats(HotCache); got.Items != 0 || got.Hits != 0 {
+		t.Errorf("hot CacheStats = %+v", got)
+	}
+}
@@ -0,0 +1,22 @@
+package groupcachetest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("Now = %v; want %v", c.Now(), start)
+	}
+	c.Advance(time.Minute)
+	if got := c.Now().Sub(start); got != time.Minute {
+		t.Errorf("after Advance(1m) the clock moved %v", got)
+	}
+	c.Set(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("after Set Now = %v; want %v", c.Now(), start)
+	}
+}
@@ -0,0 +1,601 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/gcache/consitenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The gRPC service is the GroupCache service of groupcache.proto:
+//
+//	service GroupCache {
+//	  rpc Get(GetRequest) returns (GetResponse);
+//	  rpc Set(UpdateRequest) returns (Empty);
+//	  rpc Remove(UpdateRequest) returns (Empty);
+//	  rpc SetGeneration(UpdateRequest) returns (Empty);
+//	  rpc PushHot(UpdateRequest) returns (Empty);
+//	  rpc GetBatch(GetBatchRequest) returns (GetBatchResponse);
+//	}
+//
+//	message UpdateRequest {
+//	  string group = 1;
+//	  string key = 2;
+//	  bytes value = 3;
+//	  int64 expire = 4; // Unix nanoseconds, 0 for never
+//	  uint64 generation = 15; // SetGeneration only
+//	}
+//
+// The descriptor below is what protoc-gen-go-grpc would generate for it.
+// UpdateRequest is not in groupcachepb, so it is hand-encoded with
+// protowire and sent through rawCodec, as are the batch messages
+// described in batch.go.
+const (
+	grpcGetMethod    = "/groupcachepb.GroupCache/Get"
+	grpcSetMethod    = "/groupcachepb.GroupCache/Set"
+	grpcRemoveMethod = "/groupcachepb.GroupCache/Remove"
+	grpcGenMethod    = "/groupcachepb.GroupCache/SetGeneration"
+	grpcPushMethod   = "/groupcachepb.GroupCache/PushHot"
+	grpcBatchMethod  = "/groupcachepb.GroupCache/GetBatch"
+)
+
+type groupCacheServer interface {
+	Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error)
+	Set(ctx context.Context, in *[]byte) (*[]byte, error)
+	Remove(ctx context.Context, in *[]byte) (*[]byte, error)
+	SetGeneration(ctx context.Context, in *[]byte) (*[]byte, error)
+	PushHot(ctx context.Context, in *[]byte) (*[]byte, error)
+	GetBatch(ctx context.Context, in *[]byte) (*[]byte, error)
+}
+
+var groupCacheServiceDesc = grpc.ServiceDesc{
+	ServiceName: "groupcachepb.GroupCache",
+	HandlerType: (*groupCacheServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    groupCacheGetHandler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    groupCacheUpdateHandler(grpcSetMethod, groupCacheServer.Set),
+		},
+		{
+			MethodName: "Remove",
+			Handler:    groupCacheUpdateHandler(grpcRemoveMethod, groupCacheServer.Remove),
+		},
+		{
+			MethodName: "SetGeneration",
+			Handler:    groupCacheUpdateHandler(grpcGenMethod, groupCacheServer.SetGeneration),
+		},
+		{
+			MethodName: "PushHot",
+			Handler:    groupCacheUpdateHandler(grpcPushMethod, groupCacheServer.PushHot),
+		},
+		{
+			MethodName: "GetBatch",
+			Handler:    groupCacheUpdateHandler(grpcBatchMethod, groupCacheServer.GetBatch),
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "groupcache.proto",
+}
+
+func groupCacheGetHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(groupCacheServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: grpcGetMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(groupCacheServer).Get(ctx, req.(*pb.GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func groupCacheUpdateHandler(method string, call func(groupCacheServer, context.Context, *[]byte) (*[]byte, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new([]byte)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(groupCacheServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: method,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(groupCacheServer), ctx, req.(*[]byte))
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+// rawCodec sends already encoded messages as they are.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = cloneBytes(data)
+	return nil
+}
+
+func (rawCodec) Name() string { return "groupcache-raw" }
+
+func init() {
+	// 服务端按 content-subtype 找到这个 codec
+	encoding.RegisterCodec(rawCodec{})
+}
+
+func encodeUpdateRequest(group, key string, value []byte, expire time.Time) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, group)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, key)
+	if value != nil {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, value)
+	}
+	if !expire.IsZero() {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(expire.UnixNano()))
+	}
+	return b
+}
+
+func decodeUpdateRequest(b []byte) (group, key string, value []byte, expire time.Time, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", "", nil, time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case typ == protowire.BytesType && num <= 3:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return "", "", nil, time.Time{}, protowire.ParseError(n)
+			}
+			switch num {
+			case 1:
+				group = string(v)
+			case 2:
+				key = string(v)
+			case 3:
+				value = cloneBytes(v)
+			}
+			b = b[n:]
+		case typ == protowire.VarintType && num == 4:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return "", "", nil, time.Time{}, protowire.ParseError(n)
+			}
+			expire = time.Unix(0, int64(v))
+			b = b[n:]
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return "", "", nil, time.Time{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return
+}
+
+const defaultConnsPerPeer = 2
+
+// GRPCPool implements PeerPicker for a pool of gRPC peers.
+type GRPCPool struct {
+	// OnError optionally specifies a callback for peers that could not
+	// be dialed in Set. Such peers are left out of the ring.
+	OnError func(peer string, err error)
+
+	// this peer's gRPC target, e.g. "10.0.0.1:9000"
+	self string
+
+	opts GRPCPoolOptions
+
+	mu      sync.Mutex // guards peers, getters and health
+	peers   *consitenthash.Map
+	getters map[string]*grpcGetter // keyed by target
+	health  map[string]*peerHealth
+}
+
+// GRPCPoolOptions are the configurations of a GRPCPool.
+type GRPCPoolOptions struct {
+	// Replicas specifies the number of key replicas on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consitenthash.Hash
+
+	// ConnsPerPeer is the number of client connections kept open to each
+	// peer; calls are spread over them round-robin. If blank, it defaults to 2.
+	ConnsPerPeer int
+
+	// DialOptions are used for every client connection.
+	// If blank, connections are made without transport security.
+	DialOptions []grpc.DialOption
+
+	// Health configures per-peer health tracking and circuit breaking.
+	Health HealthOptions
+
+	// Registry is the registry whose groups the pool serves and picks
+	// peers for. If nil, it defaults to DefaultRegistry().
+	Registry *Registry
+}
+
+// NewGRPCPool initializes a gRPC pool of peers and registers itself as a PeerPicker.
+// The self argument is the target other peers use to reach this process.
+// Call Register to serve the GroupCache service on a grpc.Server.
+func NewGRPCPool(self string, o *GRPCPoolOptions) *GRPCPool {
+	p := newGRPCPool(self, o)
+	r := p.opts.Registry
+	r.mu.Lock()
+	made := r.grpcPoolMade
+	r.grpcPoolMade = true
+	r.mu.Unlock()
+	if made {
+		panic("groupcache: NewGRPCPool must be called only once")
+	}
+
+	r.RegisterPeerPicker(func() PeerPicker { return p })
+	return p
+}
+
+func newGRPCPool(self string, o *GRPCPoolOptions) *GRPCPool {
+	p := &GRPCPool{
+		self:    self,
+		getters: make(map[string]*grpcGetter),
+		health:  make(map[string]*peerHealth),
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	p.opts.Health = p.opts.Health.withDefaults()
+	if p.opts.Registry == nil {
+		p.opts.Registry = defaultRegistry
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.ConnsPerPeer <= 0 {
+		p.opts.ConnsPerPeer = defaultConnsPerPeer
+	}
+	if len(p.opts.DialOptions) == 0 {
+		p.opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	p.peers = consitenthash.New(p.opts.Replicas, p.opts.HashFn)
+	return p
+}
+
+// Register serves the GroupCache service for the groups of the pool's
+// registry on s.
+func (p *GRPCPool) Register(s *grpc.Server) {
+	s.RegisterService(&groupCacheServiceDesc, grpcServer{p.opts.Registry})
+}
+
+// Set updates the pool's list of peers. Connections to peers that stay
+// in the list are kept; connections to removed peers are closed.
+func (p *GRPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	getters := make(map[string]*grpcGetter, len(peers))
+	health := make(map[string]*peerHealth, len(peers))
+	var ring []string
+	for _, peer := range peers {
+		if _, dup := getters[peer]; dup {
+			continue
+		}
+		if peer == p.self {
+			// 自己只占环上的位置 不需要连接
+			getters[peer] = nil
+			ring = append(ring, peer)
+			continue
+		}
+
+		h, ok := p.health[peer]
+		if !ok {
+			h = newPeerHealth(&p.opts.Health)
+		}
+		// health 只在拨号时设置 之后 Get 不加锁读取它
+		g, ok := p.getters[peer]
+		if !ok || g == nil {
+			var err error
+			g, err = p.dial(peer, h)
+			if err != nil {
+				if p.OnError != nil {
+					p.OnError(peer, err)
+				}
+				continue
+			}
+		}
+		getters[peer] = g
+		health[peer] = h
+		ring = append(ring, peer)
+	}
+
+	for peer, g := range p.getters {
+		if _, ok := getters[peer]; !ok && g != nil {
+			g.close()
+		}
+	}
+
+	// 连接失败的节点不放到环上
+	p.peers = consitenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers.Add(ring...)
+	p.getters = getters
+	p.health = health
+}
+
+func (p *GRPCPool) dial(target string, health *peerHealth) (*grpcGetter, error) {
+	g := &grpcGetter{target: target, conns: make([]*grpc.ClientConn, 0, p.opts.ConnsPerPeer), health: health}
+	for i := 0; i < p.opts.ConnsPerPeer; i++ {
+		conn, err := grpc.NewClient(target, p.opts.DialOptions...)
+		if err != nil {
+			g.close()
+			return nil, err
+		}
+		g.conns = append(g.conns, conn)
+	}
+	return g, nil
+}
+
+func (p *GRPCPool) PickPeer(key string) (ProtoGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peer, ok := pickHealthyPeer(p.peers, p.self, key, &p.opts.Health, p.health)
+	if !ok {
+		return nil, false
+	}
+	return p.getters[peer], true
+}
+
+// GetAll returns every peer but this process.
+func (p *GRPCPool) GetAll() []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var peers []ProtoGetter
+	for _, getter := range p.getters {
+		if getter != nil {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+// PeerHealth returns the health of every peer in the pool.
+func (p *GRPCPool) PeerHealth() map[string]PeerHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := make(map[string]PeerHealth, len(p.health))
+	for peer, h := range p.health {
+		health[peer] = h.snapshot()
+	}
+	return health
+}
+
+// Close closes every client connection. The pool must not be used afterwards.
+func (p *GRPCPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, g := range p.getters {
+		if g != nil {
+			g.close()
+		}
+	}
+	p.getters = nil
+}
+
+// grpcServer serves the groups of a registry.
+type grpcServer struct {
+	reg *Registry
+}
+
+func (s grpcServer) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
+	group := s.reg.GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+in.GetGroup())
+	}
+
+	group.Stats.ServerRequests.Add(1)
+	ctx = group.extractGRPCTrace(ctx)
+	group.observeGeneration(generationOf(in.XXX_unrecognized))
+	read, done := group.beginReplicaRead()
+	defer done()
+	view, err := group.peerGet(ctx, in.GetKey())
+	if errors.Is(err, ErrNotFound) {
+		return group.notFoundResponse(in.GetKey()), nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	group.maybeReplicate(in.GetKey(), read, view)
+	accept, _ := compressionOf(in.XXX_unrecognized)
+	res, err := group.peerResponse(view, accept)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return res, nil
+}
+
+func (s grpcServer) Set(ctx context.Context, in *[]byte) (*[]byte, error) {
+	group, key, value, expire, err := decodeUpdateRequest(*in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	g := s.reg.GetGroup(group)
+	if g == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+group)
+	}
+	g.setLocally(key, ByteView{b: value, e: expire})
+	return new([]byte), nil
+}
+
+func (s grpcServer) Remove(ctx context.Context, in *[]byte) (*[]byte, error) {
+	group, key, _, _, err := decodeUpdateRequest(*in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	g := s.reg.GetGroup(group)
+	if g == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+group)
+	}
+	g.removeLocally(key)
+	return new([]byte), nil
+}
+
+func (s grpcServer) PushHot(ctx context.Context, in *[]byte) (*[]byte, error) {
+	group, key, value, expire, err := decodeUpdateRequest(*in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	g := s.reg.GetGroup(group)
+	if g == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+group)
+	}
+	g.setHotLocally(key, generationOf(*in), ByteView{b: value, e: expire})
+	return new([]byte), nil
+}
+
+func (s grpcServer) SetGeneration(ctx context.Context, in *[]byte) (*[]byte, error) {
+	group, _, _, _, err := decodeUpdateRequest(*in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	g := s.reg.GetGroup(group)
+	if g == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+group)
+	}
+	g.observeGeneration(generationOf(*in))
+	return new([]byte), nil
+}
+
+func (s grpcServer) GetBatch(ctx context.Context, in *[]byte) (*[]byte, error) {
+	group, keys, err := decodeBatchRequest(*in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	g := s.reg.GetGroup(group)
+	if g == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+group)
+	}
+	results, err := g.serveBatch(g.extractGRPCTrace(ctx), keys)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	res := encodeBatchResponse(results)
+	return &res, nil
+}
+
+type grpcGetter struct {
+	target string
+	conns  []*grpc.ClientConn
+	next   atomic.Uint32
+	health *peerHealth
+}
+
+func (g *grpcGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	// ctx 的 deadline 会随请求一起发给对端
+	conn := g.conns[int(g.next.Add(1))%len(g.conns)]
+
+	for k, v := range traceHeaders(ctx) {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+	return g.health.call(ctx, func() error { return conn.Invoke(ctx, grpcGetMethod, in, out) })
+}
+
+func (g *grpcGetter) peerName() string { return g.target }
+
+func (g *grpcGetter) Set(ctx context.Context, group, key string, value []byte, expire time.Time) error {
+	if value == nil {
+		value = []byte{}
+	}
+	return g.update(ctx, grpcSetMethod, encodeUpdateRequest(group, key, value, expire))
+}
+
+func (g *grpcGetter) Remove(ctx context.Context, group, key string) error {
+	return g.update(ctx, grpcRemoveMethod, encodeUpdateRequest(group, key, nil, time.Time{}))
+}
+
+func (g *grpcGetter) PushHot(ctx context.Context, group, key string, gen uint64, value []byte, expire time.Time) error {
+	if value == nil {
+		value = []byte{}
+	}
+	req := encodeUpdateRequest(group, key, value, expire)
+	return g.update(ctx, grpcPushMethod, appendGeneration(req, gen))
+}
+
+func (g *grpcGetter) SetGeneration(ctx context.Context, group string, gen uint64) error {
+	req := encodeUpdateRequest(group, "", nil, time.Time{})
+	return g.update(ctx, grpcGenMethod, appendGeneration(req, gen))
+}
+
+// GetBatch fetches many keys of a group with one GetBatch call.
+func (g *grpcGetter) GetBatch(ctx context.Context, group string, keys []string) ([]BatchResult, error) {
+	conn := g.conns[int(g.next.Add(1))%len(g.conns)]
+	for k, v := range traceHeaders(ctx) {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+	req := encodeBatchRequest(group, keys)
+	var res []byte
+	err := g.health.call(ctx, func() error {
+		return conn.Invoke(ctx, grpcBatchMethod, &req, &res, grpc.ForceCodec(rawCodec{}))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeBatchResponse(res)
+}
+
+func (g *grpcGetter) update(ctx context.Context, method string, req []byte) error {
+	conn := g.conns[int(g.next.Add(1))%len(g.conns)]
+	var res []byte
+	return g.health.call(ctx, func() error {
+		return conn.Invoke(ctx, method, &req, &res, grpc.ForceCodec(rawCodec{}))
+	})
+}
+
+func (g *grpcGetter) close() {
+	for _, conn := range g.conns {
+		conn.Close()
+	}
+}
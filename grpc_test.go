@@ -0,0 +1,138 @@
+package groupcache
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"example.com/gcache/singleflight"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startBufconnServer serves the GroupCache service on an in-process listener
+func startBufconnServer(t *testing.T, p *GRPCPool) *bufconn.Listener {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	p.Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis
+}
+
+func bufconnDialOptions(lis *bufconn.Listener) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	}
+}
+
+func TestGRPCPoolGetFromPeer(t *testing.T) {
+	const name = "grpc-pool-test"
+	reg := newTestRegistry(t)
+
+	deadlines := make(chan bool, 1)
+	reg.NewGroup(name, 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		return dest.SetString("owner:" + key)
+	}), NoPeers{})
+
+	lis := startBufconnServer(t, newGRPCPool("owner", &GRPCPoolOptions{Registry: reg}))
+
+	client := newGRPCPool("client", &GRPCPoolOptions{ConnsPerPeer: 3, DialOptions: bufconnDialOptions(lis)})
+	defer client.Close()
+	client.Set("passthrough:///owner")
+
+	g := &Group{
+		name:       name,
+		getter:     GetterFunc(func(_ context.Context, key string, dest Sink) error { return dest.SetString("local:" + key) }),
+		peers:      client,
+		cacheBytes: 1 << 20,
+		loadGroup:  &singleflight.Group{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var s string
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "owner:k" {
+		t.Errorf("Get = %q; want %q", s, "owner:k")
+	}
+	if !<-deadlines {
+		t.Error("caller deadline was not propagated to the owner")
+	}
+	if got := g.Stats.PeerLoads.Get(); got != 1 {
+		t.Errorf("PeerLoads = %d; want 1", got)
+	}
+	if got := reg.GetGroup(name).Stats.ServerRequests.Get(); got != 1 {
+		t.Errorf("owner ServerRequests = %d; want 1", got)
+	}
+}
+
+func TestGRPCPoolSetKeepsConns(t *testing.T) {
+	lis := startBufconnServer(t, newGRPCPool("owner", nil))
+
+	p := newGRPCPool("self", &GRPCPoolOptions{ConnsPerPeer: 3, DialOptions: bufconnDialOptions(lis)})
+	defer p.Close()
+
+	p.Set("self", "passthrough:///a", "passthrough:///b")
+	a := p.getters["passthrough:///a"]
+	if len(a.conns) != 3 {
+		t.Fatalf("peer has %d conns; want 3", len(a.conns))
+	}
+
+	// 刷新成员 保留已有连接
+	p.Set("self", "passthrough:///a")
+	if p.getters["passthrough:///a"] != a {
+		t.Error("Set redialed a peer that stayed in the list")
+	}
+	if _, ok := p.getters["passthrough:///b"]; ok {
+		t.Error("removed peer still has a getter")
+	}
+	if _, ok := p.PeerHealth()["self"]; ok {
+		t.Error("PeerHealth reports self")
+	}
+	if a.health != p.health["passthrough:///a"] {
+		t.Error("kept getter does not share the peer's health")
+	}
+
+	// 成员刷新和正在进行的请求同时发生 -race 下不能报数据竞争
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			a.Get(context.TODO(), &pb.GetRequest{}, &pb.GetResponse{})
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		p.Set("self", "passthrough:///a")
+	}
+	<-done
+}
+
+func TestGRPCPoolNoSuchGroup(t *testing.T) {
+	lis := startBufconnServer(t, newGRPCPool("owner", nil))
+
+	p := newGRPCPool("self", &GRPCPoolOptions{DialOptions: bufconnDialOptions(lis)})
+	defer p.Close()
+	p.Set("passthrough:///owner")
+
+	g := &Group{name: "grpc-no-such-group"}
+	peer, ok := p.PickPeer("k")
+	if !ok {
+		t.Fatal("PickPeer found no peer")
+	}
+	if _, err := g.getFromPeer(context.TODO(), peer, "k"); err == nil {
+		t.Error("Get for an unknown group succeeded")
+	}
+}
@@ -0,0 +1,257 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"example.com/gcache/consitenthash"
+)
+
+// BreakerState is the state of a peer's circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed: the peer is healthy and gets its keys.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen: the peer failed too often; its keys go elsewhere.
+	BreakerOpen
+	// BreakerHalfOpen: the open period is over and a single probe
+	// request is allowed through to see if the peer recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// HealthOptions configures per-peer health tracking and circuit breaking.
+type HealthOptions struct {
+	// FailureThreshold is the number of consecutive failures that opens
+	// the breaker. If zero, it defaults to 5. Negative disables the breaker;
+	// health is still tracked.
+	FailureThreshold int
+
+	// OpenTimeout is how long an open breaker stays open before a probe
+	// request is let through. If zero, it defaults to 10s.
+	OpenTimeout time.Duration
+
+	// SlowThreshold optionally counts successful calls slower than this
+	// as failures.
+	SlowThreshold time.Duration
+
+	// LatencyDecay is the EWMA weight of the newest latency sample.
+	// If zero, it defaults to 0.2.
+	LatencyDecay float64
+
+	// NextOwner routes the keys of an unavailable peer to the next owner
+	// on the ring instead of loading them locally.
+	NextOwner bool
+
+	// Clock tells the breakers the time, for OpenTimeout and latencies.
+	// If nil, it is the system clock.
+	Clock Clock
+}
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 10 * time.Second
+	defaultLatencyDecay     = 0.2
+)
+
+func (o *HealthOptions) withDefaults() HealthOptions {
+	opts := *o
+	if opts.FailureThreshold == 0 {
+		opts.FailureThreshold = defaultFailureThreshold
+	}
+	if opts.OpenTimeout == 0 {
+		opts.OpenTimeout = defaultOpenTimeout
+	}
+	if opts.LatencyDecay <= 0 || opts.LatencyDecay > 1 {
+		opts.LatencyDecay = defaultLatencyDecay
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	return opts
+}
+
+// PeerHealth is a snapshot of one peer's health.
+type PeerHealth struct {
+	State               BreakerState
+	ConsecutiveFailures int
+	Latency             time.Duration // EWMA of call latency
+	Successes           int64
+	Failures            int64
+}
+
+// peerHealth tracks one peer and implements its circuit breaker.
+type peerHealth struct {
+	opts *HealthOptions
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int // consecutive
+	latency   float64
+	openedAt  time.Time
+	probing   bool // a half-open probe is in flight
+	successes int64
+	failed    int64
+}
+
+func newPeerHealth(opts *HealthOptions) *peerHealth {
+	return &peerHealth{opts: opts}
+}
+
+// allow reports whether a request may be sent to the peer now.
+// In the half-open state only the first caller gets through.
+func (h *peerHealth) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch h.state {
+	case BreakerOpen:
+		if h.opts.Clock.Now().Sub(h.openedAt) < h.opts.OpenTimeout {
+			return false
+		}
+		h.state = BreakerHalfOpen
+		h.probing = true
+		return true
+	case BreakerHalfOpen:
+		if h.probing {
+			return false
+		}
+		h.probing = true
+		return true
+	}
+	return true
+}
+
+// available is like allow but does not claim the half-open probe.
+func (h *peerHealth) available() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch h.state {
+	case BreakerOpen:
+		return h.opts.Clock.Now().Sub(h.openedAt) >= h.opts.OpenTimeout
+	case BreakerHalfOpen:
+		return !h.probing
+	}
+	return true
+}
+
+// call runs fn, one request to the peer, if the breaker lets it through
+// and records its outcome. The half-open probe is claimed here rather
+// than when the peer is picked, so every claim is released by record.
+func (h *peerHealth) call(ctx context.Context, fn func() error) error {
+	if h == nil {
+		return fn()
+	}
+	if !h.allow() {
+		return errBreakerOpen
+	}
+	start := h.opts.Clock.Now()
+	err := fn()
+	h.record(ctx, err, h.opts.Clock.Now().Sub(start))
+	return err
+}
+
+// record reports the outcome of one call to the peer.
+func (h *peerHealth) record(ctx context.Context, err error, d time.Duration) {
+	// 调用方取消或超时不能算作节点的错误
+	if err != nil && ctx.Err() != nil {
+		h.mu.Lock()
+		h.probing = false
+		h.mu.Unlock()
+		return
+	}
+	if err == nil && h.opts.SlowThreshold > 0 && d > h.opts.SlowThreshold {
+		err = errSlowPeer
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.latency == 0 {
+		h.latency = float64(d)
+	} else {
+		h.latency += h.opts.LatencyDecay * (float64(d) - h.latency)
+	}
+	h.probing = false
+
+	if err == nil {
+		h.successes++
+		h.failures = 0
+		h.state = BreakerClosed
+		return
+	}
+
+	h.failed++
+	h.failures++
+	if h.state == BreakerHalfOpen ||
+		(h.opts.FailureThreshold > 0 && h.failures >= h.opts.FailureThreshold) {
+		h.state = BreakerOpen
+		h.openedAt = h.opts.Clock.Now()
+	}
+}
+
+func (h *peerHealth) snapshot() PeerHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := h.state
+	if state == BreakerOpen && h.opts.Clock.Now().Sub(h.openedAt) >= h.opts.OpenTimeout {
+		state = BreakerHalfOpen
+	}
+	return PeerHealth{
+		State:               state,
+		ConsecutiveFailures: h.failures,
+		Latency:             time.Duration(h.latency),
+		Successes:           h.successes,
+		Failures:            h.failed,
+	}
+}
+
+var (
+	errSlowPeer    = errors.New("groupcache: peer slower than SlowThreshold")
+	errBreakerOpen = errors.New("groupcache: peer circuit breaker is open")
+)
+
+// pickHealthyPeer returns the peer a key should be fetched from, skipping
+// peers whose breaker is open. ok is false when the key should be loaded
+// locally. It does not claim a half-open probe; the getter does when it
+// sends the request. The caller holds the lock guarding ring and health.
+func pickHealthyPeer(ring *consitenthash.Map, self, key string, opts *HealthOptions, health map[string]*peerHealth) (peer string, ok bool) {
+	if ring.IsEmpty() {
+		return "", false
+	}
+	peer = ring.Get(key)
+	if peer == self {
+		return "", false
+	}
+	if health[peer].available() {
+		return peer, true
+	}
+
+	// 熔断中 交给环上的下一个节点或者本地加载
+	if !opts.NextOwner {
+		return "", false
+	}
+	next := ring.GetUsable(key, func(peer string) bool {
+		return peer == self || health[peer].available()
+	})
+	if next == "" || next == self {
+		return "", false
+	}
+	return next, true
+}
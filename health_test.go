@@ -0,0 +1,194 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/gcache/groupcachetest"
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+func TestPeerHealthBreaker(t *testing.T) {
+	clk := groupcachetest.NewFakeClock(time.Now())
+	opts := (&HealthOptions{FailureThreshold: 3, OpenTimeout: 20 * time.Millisecond, Clock: clk}).withDefaults()
+	h := newPeerHealth(&opts)
+	ctx := context.TODO()
+	someErr := errors.New("peer down")
+
+	for i := 0; i < 2; i++ {
+		h.record(ctx, someErr, time.Millisecond)
+	}
+	if !h.allow() {
+		t.Fatal("breaker opened before FailureThreshold")
+	}
+	h.record(ctx, someErr, time.Millisecond)
+	if h.allow() {
+		t.Fatal("breaker still closed after FailureThreshold failures")
+	}
+	if got := h.snapshot(); got.State != BreakerOpen || got.ConsecutiveFailures != 3 {
+		t.Fatalf("snapshot = %+v; want open with 3 failures", got)
+	}
+
+	// 熔断时间过后 只放行一个探测请求
+	clk.Advance(20*time.Millisecond - time.Nanosecond)
+	if h.allow() {
+		t.Fatal("probe allowed before OpenTimeout")
+	}
+	clk.Advance(time.Nanosecond)
+	if !h.allow() {
+		t.Fatal("no probe allowed after OpenTimeout")
+	}
+	if h.allow() {
+		t.Fatal("second request allowed while the probe is in flight")
+	}
+
+	// 探测失败 重新熔断
+	h.record(ctx, someErr, time.Millisecond)
+	if h.allow() {
+		t.Fatal("breaker closed after a failed probe")
+	}
+
+	clk.Advance(20 * time.Millisecond)
+	if !h.allow() {
+		t.Fatal("no probe allowed after OpenTimeout")
+	}
+	h.record(ctx, nil, time.Millisecond)
+	if got := h.snapshot(); got.State != BreakerClosed || got.ConsecutiveFailures != 0 {
+		t.Fatalf("snapshot after good probe = %+v; want closed", got)
+	}
+}
+
+func TestPeerHealthIgnoresCallerCancel(t *testing.T) {
+	opts := (&HealthOptions{FailureThreshold: 1}).withDefaults()
+	h := newPeerHealth(&opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.record(ctx, ctx.Err(), time.Millisecond)
+	if !h.allow() {
+		t.Fatal("caller cancellation opened the breaker")
+	}
+}
+
+func TestPeerHealthSlowThreshold(t *testing.T) {
+	opts := (&HealthOptions{FailureThreshold: 1, SlowThreshold: 10 * time.Millisecond}).withDefaults()
+	h := newPeerHealth(&opts)
+
+	h.record(context.TODO(), nil, 50*time.Millisecond)
+	if h.allow() {
+		t.Fatal("slow call did not count as a failure")
+	}
+	if got := h.snapshot().Latency; got != 50*time.Millisecond {
+		t.Errorf("Latency = %v; want 50ms", got)
+	}
+}
+
+func TestHTTPPoolBreaker(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	up := httptest.NewServer(http.NotFoundHandler())
+	defer up.Close()
+
+	p := newHTTPPool("http://self", &HTTPPoolOptions{
+		Health: HealthOptions{FailureThreshold: 2, OpenTimeout: time.Hour, NextOwner: true},
+	})
+	p.Set(down.URL, up.URL)
+
+	// 找一个属于 down 的 key
+	var key string
+	for i := 0; ; i++ {
+		key = string(rune('a' + i))
+		if peer, _ := p.PickPeer(key); peer.(*httpGetter).baseURL == down.URL+defaultBasePath {
+			break
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		peer, ok := p.PickPeer(key)
+		if !ok {
+			t.Fatal("PickPeer found no peer")
+		}
+		if err := peer.Get(context.TODO(), &pb.GetRequest{}, &pb.GetResponse{}); err == nil {
+			t.Fatal("Get to a closed server succeeded")
+		}
+	}
+
+	if got := p.PeerHealth()[down.URL]; got.State != BreakerOpen {
+		t.Fatalf("down peer state = %v; want open", got.State)
+	}
+	peer, ok := p.PickPeer(key)
+	if !ok || peer.(*httpGetter).baseURL != up.URL+defaultBasePath {
+		t.Fatalf("PickPeer with open breaker = %v, %v; want the next owner", peer, ok)
+	}
+
+	// 成员刷新不会重置健康状态
+	p.Set(down.URL, up.URL)
+	if got := p.PeerHealth()[down.URL]; got.State != BreakerOpen {
+		t.Errorf("down peer state after Set = %v; want open", got.State)
+	}
+
+	// 不启用 NextOwner 时本地加载
+	p.opts.Health.NextOwner = false
+	if _, ok := p.PickPeer(key); ok {
+		t.Error("PickPeer with open breaker and no NextOwner returned a peer")
+	}
+}
+
+func TestHTTPPoolHalfOpenUpdate(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	clk := groupcachetest.NewFakeClock(time.Now())
+	p := newHTTPPool("http://self", &HTTPPoolOptions{
+		Health: HealthOptions{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond, Clock: clk},
+	})
+	p.Set(srv.URL)
+	peer, _ := p.PickPeer("k")
+	if err := peer.(*httpGetter).Remove(context.TODO(), "g", "k"); err == nil {
+		t.Fatal("Remove on a failing peer succeeded")
+	}
+	if got := p.PeerHealth()[srv.URL]; got.State != BreakerOpen {
+		t.Fatalf("state after a failed Remove = %v; want open", got.State)
+	}
+
+	// 选中节点不占用探测 真正发请求时才占用并在结束时释放
+	clk.Advance(10 * time.Millisecond)
+	failing.Store(false)
+	for i := 0; i < 2; i++ {
+		if _, ok := p.PickPeer("k"); !ok {
+			t.Fatalf("PickPeer %d refused a half-open peer", i)
+		}
+	}
+	if err := peer.(*httpGetter).Remove(context.TODO(), "g", "k"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.PeerHealth()[srv.URL]; got.State != BreakerClosed {
+		t.Errorf("state after a good probe = %v; want closed", got.State)
+	}
+}
+
+func TestPeerHealthLatencyOnClock(t *testing.T) {
+	clk := groupcachetest.NewFakeClock(time.Now())
+	opts := (&HealthOptions{Clock: clk}).withDefaults()
+	h := newPeerHealth(&opts)
+	h.call(context.TODO(), func() error {
+		clk.Advance(7 * time.Millisecond)
+		return nil
+	})
+	if got := h.snapshot().Latency; got != 7*time.Millisecond {
+		t.Errorf("Latency = %v; want 7ms", got)
+	}
+}
@@ -0,0 +1,136 @@
+package groupcache
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// histogramBuckets is the number of buckets of a Histogram. Bucket i
+// counts latencies up to 1µs<<i; the last bucket counts everything
+// slower than about 8s.
+const histogramBuckets = 25
+
+// Histogram is a latency histogram with fixed log-scale buckets. It is
+// safe for concurrent use without locks; the zero value is ready to use.
+type Histogram struct {
+	buckets [histogramBuckets]AtomicInt
+	count   AtomicInt
+	sum     AtomicInt // nanoseconds
+}
+
+// Observe records one latency.
+func (h *Histogram) Observe(d time.Duration) {
+	h.buckets[bucketOf(d)].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func bucketOf(d time.Duration) int {
+	if d <= time.Microsecond {
+		return 0
+	}
+	// (d-1)/1µs 的位数就是 1µs<<i >= d 的最小 i
+	i := bits.Len64(uint64((d - 1) / time.Microsecond))
+	if i >= histogramBuckets {
+		i = histogramBuckets - 1
+	}
+	return i
+}
+
+// bucketBound returns the upper bound of bucket i.
+func bucketBound(i int) time.Duration {
+	if i == histogramBuckets-1 {
+		return math.MaxInt64
+	}
+	return time.Microsecond << i
+}
+
+// HistogramBucket is one bucket of a HistogramSnapshot.
+type HistogramBucket struct {
+	UpperBound time.Duration // inclusive; math.MaxInt64 for the last
+	Count      int64         // 只包含本桶 不累加
+}
+
+// HistogramSnapshot is a copy of a Histogram at one point in time.
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket
+	Count   int64
+	Sum     time.Duration
+}
+
+// Snapshot returns a copy of the histogram. Observations made while it is
+// taken may be counted in some fields but not others.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		Buckets: make([]HistogramBucket, histogramBuckets),
+		Count:   h.count.Get(),
+		Sum:     time.Duration(h.sum.Get()),
+	}
+	for i := range s.Buckets {
+		s.Buckets[i] = HistogramBucket{UpperBound: bucketBound(i), Count: h.buckets[i].Get()}
+	}
+	return s
+}
+
+// Quantile returns the upper bound of the bucket holding the q-quantile,
+// or 0 if nothing was observed.
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	var total int64
+	for _, b := range s.Buckets {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(total)))
+	var n int64
+	for _, b := range s.Buckets {
+		n += b.Count
+		if n >= rank && n > 0 {
+			return b.UpperBound
+		}
+	}
+	return s.Buckets[len(s.Buckets)-1].UpperBound
+}
+
+// peerHistograms holds one Histogram per peer.
+type peerHistograms struct {
+	m sync.Map // peer name -> *Histogram
+}
+
+func (p *peerHistograms) observe(peer string, d time.Duration) {
+	h, ok := p.m.Load(peer)
+	if !ok {
+		h, _ = p.m.LoadOrStore(peer, new(Histogram))
+	}
+	h.(*Histogram).Observe(d)
+}
+
+func (p *peerHistograms) snapshot() map[string]HistogramSnapshot {
+	out := make(map[string]HistogramSnapshot)
+	p.m.Range(func(k, v interface{}) bool {
+		out[k.(string)] = v.(*Histogram).Snapshot()
+		return true
+	})
+	return out
+}
+
+// PeerLatencies returns the latency of ProtoGetter.Get calls per peer.
+func (s *Stats) PeerLatencies() map[string]HistogramSnapshot {
+	return s.peerLatency.snapshot()
+}
+
+// peerNamer is implemented by the ProtoGetters of this package to label
+// their latencies.
+type peerNamer interface {
+	peerName() string
+}
+
+func peerName(peer ProtoGetter) string {
+	if p, ok := peer.(peerNamer); ok {
+		return p.peerName()
+	}
+	return "other"
+}
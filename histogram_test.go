@@ -0,0 +1,122 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBucketOf(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Microsecond, 0},
+		{time.Microsecond + 1, 1},
+		{2 * time.Microsecond, 1},
+		{3 * time.Microsecond, 2},
+		{time.Millisecond, 10},
+		{time.Hour, histogramBuckets - 1},
+	} {
+		if got := bucketOf(tt.d); got != tt.want {
+			t.Errorf("bucketOf(%v) = %d; want %d", tt.d, got, tt.want)
+		}
+		if tt.want < histogramBuckets-1 && tt.d > bucketBound(tt.want) {
+			t.Errorf("%v is above the bound of its bucket %v", tt.d, bucketBound(tt.want))
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 90; j++ {
+				h.Observe(100 * time.Microsecond)
+			}
+			for j := 0; j < 10; j++ {
+				h.Observe(50 * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := h.Snapshot()
+	if s.Count != 1000 {
+		t.Errorf("Count = %d; want 1000", s.Count)
+	}
+	if want := 900*100*time.Microsecond + 100*50*time.Millisecond; s.Sum != want {
+		t.Errorf("Sum = %v; want %v", s.Sum, want)
+	}
+	if q := s.Quantile(0.5); q != 128*time.Microsecond {
+		t.Errorf("p50 = %v; want 128µs", q)
+	}
+	if q := s.Quantile(0.99); q != 65536*time.Microsecond {
+		t.Errorf("p99 = %v; want 65.536ms", q)
+	}
+	if q := (HistogramSnapshot{}).Quantile(0.5); q != 0 {
+		t.Errorf("empty p50 = %v", q)
+	}
+}
+
+func TestLatencyStats(t *testing.T) {
+	const name = "latency-stats"
+	reg := newTestRegistry(t)
+	reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		time.Sleep(time.Millisecond)
+		return dest.SetString("owner")
+	}), NoPeers{})
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: reg}))
+	defer ts.Close()
+	peer := &httpGetter{baseURL: ts.URL + defaultBasePath}
+
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), keyPicker{prefix: "r-", peer: peer})
+
+	var s string
+	for _, key := range []string{"r-1", "r-2", "l-1", "r-1"} {
+		if err := g.Get(context.TODO(), key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := g.Stats.GetLatency.Snapshot().Count; n != 4 {
+		t.Errorf("GetLatency count = %d; want 4", n)
+	}
+	if n := g.Stats.LocalLoadLatency.Snapshot().Count; n != 1 {
+		t.Errorf("LocalLoadLatency count = %d; want 1", n)
+	}
+	peerLoads := g.Stats.PeerLoadLatency.Snapshot()
+	// r-1 不热 不会进 hotCache 第二次还是远程获取
+	if peerLoads.Count != 3 {
+		t.Errorf("PeerLoadLatency count = %d; want 3", peerLoads.Count)
+	}
+	if peerLoads.Sum < 2*time.Millisecond {
+		t.Errorf("PeerLoadLatency sum = %v; want at least the owner's 2ms", peerLoads.Sum)
+	}
+	peers := g.Stats.PeerLatencies()
+	if len(peers) != 1 || peers[peer.baseURL].Count != 3 {
+		t.Errorf("PeerLatencies = %v; want 3 requests to %s", peers, peer.baseURL)
+	}
+
+	var b strings.Builder
+	writeMetrics(&b, []*Group{g})
+	for _, want := range []string{
+		"# TYPE groupcache_get_latency_seconds histogram\n",
+		`groupcache_get_latency_seconds_bucket{group="latency-stats",le="+Inf"} 4` + "\n",
+		`groupcache_get_latency_seconds_count{group="latency-stats"} 4` + "\n",
+		`groupcache_peer_latency_seconds_count{group="latency-stats",peer="` + peer.baseURL + `"} 3` + "\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
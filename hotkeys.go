@@ -0,0 +1,300 @@
+package groupcache
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HotKeyOptions configures how a Group finds the keys worth keeping in
+// its hotCache.
+//
+// Every Get counts towards its key's rate, an exponentially decaying
+// count of requests over Window. A value fetched from a peer is kept in
+// hotCache when the key's rate is at least Threshold.
+type HotKeyOptions struct {
+	// Threshold is the rate in requests per second that makes a key hot.
+	// If zero, it defaults to 1. Negative disables tracking, and values
+	// from peers are then kept one time in ten at random.
+	Threshold float64
+
+	// Window is the time constant of the decay. If zero, it defaults
+	// to one minute.
+	Window time.Duration
+
+	// MaxKeys bounds the number of keys tracked. When it is reached the
+	// colder half is forgotten. If zero, it defaults to 10000.
+	MaxKeys int
+}
+
+const (
+	defaultHotThreshold = 1
+	defaultHotWindow    = time.Minute
+	defaultHotMaxKeys   = 10000
+)
+
+func (o *HotKeyOptions) withDefaults() HotKeyOptions {
+	opts := *o
+	if opts.Threshold == 0 {
+		opts.Threshold = defaultHotThreshold
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultHotWindow
+	}
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = defaultHotMaxKeys
+	}
+	return opts
+}
+
+// SetHotKeyOptions sets the group's hot key detection options. It must
+// be called before the group serves its first Get.
+func (g *Group) SetHotKeyOptions(o HotKeyOptions) {
+	g.hot.opts = o.withDefaults()
+}
+
+// HotKey is a key and its current request rate.
+type HotKey struct {
+	Key string
+	QPS float64
+}
+
+// HotKeys returns up to n of the group's most requested keys, hottest
+// first.
+func (g *Group) HotKeys(n int) []HotKey {
+	return g.hot.top(n, g.now())
+}
+
+// hotKeys tracks the request rate of each key. The zero value uses the
+// default options.
+//
+// Every Get, cache hits included, counts a hit, so the keys are spread
+// over shards with a lock each instead of one lock for the group.
+type hotKeys struct {
+	opts HotKeyOptions
+
+	n        atomic.Int64 // keys tracked in all shards
+	sweeping atomic.Bool
+	shards   [hotShards]hotShard
+}
+
+const hotShards = 32
+
+type hotShard struct {
+	mu   sync.Mutex
+	keys map[string]*keyRate
+	_    [48]byte // 不和相邻的分片共用缓存行
+}
+
+// shard returns the shard of key, chosen by its FNV-1a hash.
+func (h *hotKeys) shard(key string) *hotShard {
+	x := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		x ^= uint32(key[i])
+		x *= 16777619
+	}
+	return &h.shards[x%hotShards]
+}
+
+// keyRate is a request count decaying with time constant Window, so in
+// a steady state count/Window is the key's QPS.
+type keyRate struct {
+	count float64
+	last  time.Time
+}
+
+func (r *keyRate) decayed(now time.Time, window time.Duration) float64 {
+	dt := now.Sub(r.last)
+	if dt <= 0 {
+		return r.count
+	}
+	return r.count * math.Exp(-float64(dt)/float64(window))
+}
+
+func (h *hotKeys) options() HotKeyOptions {
+	if h.opts.Window == 0 {
+		return h.opts.withDefaults()
+	}
+	return h.opts
+}
+
+func (h *hotKeys) disabled() bool {
+	return h.opts.Threshold < 0
+}
+
+// hit counts one request for key.
+func (h *hotKeys) hit(key string, now time.Time) {
+	if h.disabled() {
+		return
+	}
+	opts := h.options()
+	if h.n.Load() >= int64(opts.MaxKeys) {
+		h.sweep(now, opts)
+	}
+
+	s := h.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.keys[key]
+	if !ok {
+		if s.keys == nil {
+			s.keys = make(map[string]*keyRate)
+		}
+		r = &keyRate{last: now}
+		s.keys[key] = r
+		h.n.Add(1)
+	}
+	r.count = r.decayed(now, opts.Window) + 1
+	r.last = now
+}
+
+// sweep forgets the colder half of the tracked keys. It holds one shard
+// lock at a time and finds the median in linear time, so Gets of other
+// shards go on meanwhile. If another sweep is running it returns at once.
+// 每次删除一半 摊还下来每次 hit 是常数时间
+func (h *hotKeys) sweep(now time.Time, opts HotKeyOptions) {
+	if !h.sweeping.CompareAndSwap(false, true) {
+		return
+	}
+	defer h.sweeping.Store(false)
+
+	counts := make([]float64, 0, h.n.Load())
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.mu.Lock()
+		for _, r := range s.keys {
+			counts = append(counts, r.decayed(now, opts.Window))
+		}
+		s.mu.Unlock()
+	}
+	drop := len(counts) / 2
+	if drop == 0 {
+		return
+	}
+	median := nthSmallest(counts, drop)
+	// 比中位数冷的都删掉 相等的删到凑够一半为止
+	ties := drop
+	for _, c := range counts[:drop] {
+		if c < median {
+			ties--
+		}
+	}
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.mu.Lock()
+		for key, r := range s.keys {
+			c := r.decayed(now, opts.Window)
+			if c < median || (c == median && ties > 0) {
+				if c == median {
+					ties--
+				}
+				delete(s.keys, key)
+				h.n.Add(-1)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// nthSmallest returns the n-th smallest value of a, counting from 0,
+// and leaves the n smallest values in a[:n]. It reorders a.
+func nthSmallest(a []float64, n int) float64 {
+	lo, hi := 0, len(a)-1
+	for lo < hi {
+		// 三数取中做枢轴 避免有序输入退化
+		mid := lo + (hi-lo)/2
+		if a[mid] < a[lo] {
+			a[mid], a[lo] = a[lo], a[mid]
+		}
+		if a[hi] < a[lo] {
+			a[hi], a[lo] = a[lo], a[hi]
+		}
+		if a[hi] < a[mid] {
+			a[hi], a[mid] = a[mid], a[hi]
+		}
+		pivot := a[mid]
+		i, j := lo, hi
+		for i <= j {
+			for a[i] < pivot {
+				i++
+			}
+			for a[j] > pivot {
+				j--
+			}
+			if i <= j {
+				a[i], a[j] = a[j], a[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case n <= j:
+			hi = j
+		case n >= i:
+			lo = i
+		default:
+			return a[n]
+		}
+	}
+	return a[n]
+}
+
+// qps returns the current request rate of key.
+func (h *hotKeys) qps(key string, now time.Time) float64 {
+	opts := h.options()
+
+	s := h.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.keys[key]
+	if !ok {
+		return 0
+	}
+	return r.decayed(now, opts.Window) / opts.Window.Seconds()
+}
+
+// clear forgets every key.
+func (h *hotKeys) clear() {
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.mu.Lock()
+		h.n.Add(-int64(len(s.keys)))
+		s.keys = nil
+		s.mu.Unlock()
+	}
+}
+
+// isHot reports whether key is requested at least Threshold times per
+// second.
+func (h *hotKeys) isHot(key string, now time.Time) bool {
+	return h.qps(key, now) >= h.options().Threshold
+}
+
+func (h *hotKeys) top(n int, now time.Time) []HotKey {
+	opts := h.options()
+
+	keys := make([]HotKey, 0, h.n.Load())
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.mu.Lock()
+		for key, r := range s.keys {
+			keys = append(keys, HotKey{Key: key, QPS: r.decayed(now, opts.Window) / opts.Window.Seconds()})
+		}
+		s.mu.Unlock()
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].QPS != keys[j].QPS {
+			return keys[i].QPS > keys[j].QPS
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if n >= 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
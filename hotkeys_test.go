@@ -0,0 +1,149 @@
+package groupcache
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+type protoGetterFunc func(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error
+
+func (f protoGetterFunc) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	return f(ctx, in, out)
+}
+
+func TestHotKeysDecay(t *testing.T) {
+	var h hotKeys
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		h.hit("k", now)
+	}
+	if qps := h.qps("k", now); qps < 0.99 || qps > 1.01 {
+		t.Errorf("qps = %v; want 1", qps)
+	}
+	if !h.isHot("k", now) {
+		t.Error("k is not hot after 60 requests")
+	}
+
+	// 一个时间常数之后衰减到 1/e
+	later := now.Add(time.Minute)
+	if h.isHot("k", later) {
+		t.Errorf("k still hot a minute later, qps %v", h.qps("k", later))
+	}
+	if h.qps("unknown", now) != 0 {
+		t.Error("untracked key has a rate")
+	}
+}
+
+func TestHotKeysTop(t *testing.T) {
+	var h hotKeys
+	now := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		for j := 0; j <= i; j++ {
+			h.hit(key, now)
+		}
+	}
+	top := h.top(2, now)
+	if len(top) != 2 || top[0].Key != "c" || top[1].Key != "b" {
+		t.Errorf("top(2) = %v; want c, b", top)
+	}
+	if len(h.top(10, now)) != 3 {
+		t.Errorf("top(10) = %v; want 3 keys", h.top(10, now))
+	}
+}
+
+func TestHotKeysMaxKeys(t *testing.T) {
+	h := hotKeys{opts: (&HotKeyOptions{MaxKeys: 4}).withDefaults()}
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		h.hit("hot", now)
+	}
+	for i := 0; i < 20; i++ {
+		h.hit("cold"+strconv.Itoa(i), now)
+		if n := h.n.Load(); n > 4 {
+			t.Fatalf("tracking %d keys; want at most 4", n)
+		}
+	}
+	if h.qps("hot", now) == 0 {
+		t.Error("the hottest key was forgotten")
+	}
+	if n := len(h.top(-1, now)); int64(n) != h.n.Load() {
+		t.Errorf("shards hold %d keys; counted %d", n, h.n.Load())
+	}
+}
+
+func TestNthSmallest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for size := 1; size < 50; size++ {
+		a := make([]float64, size)
+		for i := range a {
+			a[i] = float64(r.Intn(10)) // 有很多相等的值
+		}
+		sorted := append([]float64(nil), a...)
+		sort.Float64s(sorted)
+		n := r.Intn(size)
+		if got := nthSmallest(a, n); got != sorted[n] {
+			t.Fatalf("nthSmallest(%v, %d) = %v; want %v", sorted, n, got, sorted[n])
+		}
+		for _, v := range a[:n] {
+			if v > sorted[n] {
+				t.Fatalf("a[:%d] holds %v, more than the %d-th smallest", n, v, n)
+			}
+		}
+	}
+}
+
+// BenchmarkHotKeysHit measures hits from many goroutines, as every Get
+// of a group does.
+func BenchmarkHotKeysHit(b *testing.B) {
+	var h hotKeys
+	now := time.Now()
+	var next atomic.Int32
+	b.RunParallel(func(pb *testing.PB) {
+		key := "key" + strconv.Itoa(int(next.Add(1)))
+		for pb.Next() {
+			h.hit(key, now)
+		}
+	})
+}
+
+func TestHotKeyPromotion(t *testing.T) {
+	var peerGets atomic.Int32
+	peer := protoGetterFunc(func(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+		peerGets.Add(1)
+		out.Value = []byte("remote:" + in.GetKey())
+		return nil
+	})
+	g := newTestGroup("hot-key-promotion", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), keyPicker{prefix: "", peer: peer})
+	ctx := context.TODO()
+
+	var s string
+	g.Get(ctx, "cold", StringSink(&s))
+	if n := g.hotCache.items(); n != 0 {
+		t.Fatalf("cold key promoted, hotCache has %d items", n)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := g.Get(ctx, "hot", StringSink(&s)); err != nil || s != "remote:hot" {
+			t.Fatalf("Get = %q, %v", s, err)
+		}
+	}
+	// 达到每秒一次之后不再访问拥有者
+	if n := peerGets.Load() - 1; n < 55 || n > 65 {
+		t.Errorf("hot key fetched from peer %d times; want about 60", n)
+	}
+	if n := g.hotCache.items(); n != 1 {
+		t.Errorf("hotCache has %d items; want 1", n)
+	}
+	if top := g.HotKeys(1); len(top) != 1 || top[0].Key != "hot" {
+		t.Errorf("HotKeys(1) = %v; want hot", top)
+	}
+}
@@ -0,0 +1,512 @@
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/gcache/consitenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+const defaultBasePath = "/_groupcache/"
+
+const defaultReplicas = 50
+
+// HTTPPool implements PeerPicker for a pool of HTTP peers.
+type HTTPPool struct {
+	// Context optionally specifies a context for the server to use when it
+	// receives a request.
+	// If nil, the server uses the request's context
+	Context func(*http.Request) context.Context
+
+	// Transport optionally specifies an http.RoundTripper for the client
+	// to use when it makes a request.
+	// If nil, the client uses http.DefaultTransport.
+	Transport func(context.Context) http.RoundTripper
+
+	// this peer's base URL, e.g. "https://example.net:8000"
+	self string
+
+	opts HTTPPoolOptions
+
+	mu          sync.Mutex // guards peers, httpGetters and health
+	peers       *consitenthash.Map
+	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
+	health      map[string]*peerHealth // survives Set for peers that stay
+}
+
+// HTTPPoolOptions are the configurations of a HTTPPool.
+type HTTPPoolOptions struct {
+	// BasePath specifies the HTTP path that will serve groupcache requests.
+	// If blank, it defaults to "/_groupcache/".
+	BasePath string
+
+	// Replicas specifies the number of key replicas on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consitenthash.Hash
+
+	// Health configures per-peer health tracking and circuit breaking.
+	Health HealthOptions
+
+	// Registry is the registry whose groups the pool serves and picks
+	// peers for. If nil, it defaults to DefaultRegistry().
+	Registry *Registry
+}
+
+// NewHTTPPool initializes an HTTP pool of peers, and registers itself as a PeerPicker.
+// For convenience, it also registers itself as an http.Handler with http.DefaultServeMux.
+// The self argument should be a valid base URL that points to the current server,
+// for example "http://example.net:8000".
+func NewHTTPPool(self string) *HTTPPool {
+	p := NewHTTPPoolOpts(self, nil)
+	http.Handle(p.opts.BasePath, p)
+	return p
+}
+
+// NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
+// Unlike NewHTTPPool, this function does not register the created pool as an HTTP handler.
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := newHTTPPool(self, o)
+	r := p.opts.Registry
+	r.mu.Lock()
+	made := r.httpPoolMade
+	r.httpPoolMade = true
+	r.mu.Unlock()
+	if made {
+		panic("groupcache: NewHTTPPool must be called only once")
+	}
+
+	r.RegisterPeerPicker(func() PeerPicker { return p })
+	return p
+}
+
+// newHTTPPool builds a pool without touching the global registration
+func newHTTPPool(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{
+		self:        self,
+		httpGetters: make(map[string]*httpGetter),
+		health:      make(map[string]*peerHealth),
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	p.opts.Health = p.opts.Health.withDefaults()
+	if p.opts.Registry == nil {
+		p.opts.Registry = defaultRegistry
+	}
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	p.peers = consitenthash.New(p.opts.Replicas, p.opts.HashFn)
+	return p
+}
+
+// Set updates the pool's list of peers.
+// Each peer value should be a valid base URL,
+// for example "http://example.net:8000".
+func (p *HTTPPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 节点变化时直接重建整个环
+	p.peers = consitenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers.Add(peers...)
+	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	health := make(map[string]*peerHealth, len(peers))
+	for _, peer := range peers {
+		// 成员刷新时保留已有节点的健康状态
+		h, ok := p.health[peer]
+		if !ok {
+			h = newPeerHealth(&p.opts.Health)
+		}
+		health[peer] = h
+		p.httpGetters[peer] = &httpGetter{transport: p.Transport, baseURL: peer + p.opts.BasePath, health: h}
+	}
+	p.health = health
+}
+
+func (p *HTTPPool) PickPeer(key string) (ProtoGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peer, ok := pickHealthyPeer(p.peers, p.self, key, &p.opts.Health, p.health)
+	if !ok {
+		return nil, false
+	}
+	return p.httpGetters[peer], true
+}
+
+// GetAll returns every peer but this process.
+func (p *HTTPPool) GetAll() []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var peers []ProtoGetter
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+// PeerHealth returns the health of every peer in the pool.
+func (p *HTTPPool) PeerHealth() map[string]PeerHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := make(map[string]PeerHealth, len(p.health))
+	for peer, h := range p.health {
+		health[peer] = h.snapshot()
+	}
+	return health
+}
+
+func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Parse request.
+	// <basepath>/<groupname>/<key>
+	if !strings.HasPrefix(r.URL.Path, p.opts.BasePath) {
+		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+	}
+	// 按转义后的路径切分 key 里的 / 和 % 才能原样还原
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, p.opts.BasePath) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(path[len(p.opts.BasePath):], "/", 2)
+	for i, part := range parts {
+		s, err := url.PathUnescape(part)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		parts[i] = s
+	}
+	// PUT <basepath>/<groupname> 只带代 没有 key
+	if len(parts) != 2 && (len(parts) != 1 || r.Method != http.MethodPut) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	groupName := parts[0]
+	var key string
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+
+	// Fetch the value for this group/key.
+	group := p.opts.Registry.GetGroup(groupName)
+	if group == nil {
+		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		return
+	}
+	var ctx context.Context
+	if p.Context != nil {
+		ctx = p.Context(r)
+	} else {
+		ctx = r.Context()
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		// POST <basepath>/<groupname>/ 是批量请求
+		p.serveBatch(ctx, w, r, group)
+		return
+	case http.MethodPut:
+		if len(parts) == 1 {
+			p.serveGeneration(w, r, group)
+			return
+		}
+		p.serveSet(w, r, group, key)
+		return
+	case http.MethodDelete:
+		group.removeLocally(key)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	group.Stats.ServerRequests.Add(1)
+	ctx = group.extractHTTPTrace(ctx, r.Header)
+	if gen, err := strconv.ParseUint(r.URL.Query().Get("gen"), 10, 64); err == nil {
+		group.observeGeneration(gen)
+	}
+	read, done := group.beginReplicaRead()
+	defer done()
+	var res *pb.GetResponse
+	view, err := group.peerGet(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		res, err = group.notFoundResponse(key), nil
+	} else if err == nil {
+		group.maybeReplicate(key, read, view)
+		res, err = group.peerResponse(view, r.URL.Query().Get("z"))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write the value to the response body as a proto message.
+	body, err := proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(body)
+}
+
+// serveSet stores the request body in the main cache, or in the hot
+// cache if the hot query parameter is set.
+// The optional expire query parameter is a Unix time in nanoseconds; a
+// hot value also carries the pusher's generation in gen.
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	var expire time.Time
+	if e := r.URL.Query().Get("expire"); e != "" {
+		ns, err := strconv.ParseInt(e, 10, 64)
+		if err != nil {
+			http.Error(w, "bad expire: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		expire = time.Unix(0, ns)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("hot") != "" {
+		var gen uint64
+		if g := r.URL.Query().Get("gen"); g != "" {
+			if gen, err = strconv.ParseUint(g, 10, 64); err != nil {
+				http.Error(w, "bad gen: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		group.setHotLocally(key, gen, ByteView{b: body, e: expire})
+	} else {
+		group.setLocally(key, ByteView{b: body, e: expire})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveGeneration raises the group's generation to the gen query parameter.
+func (p *HTTPPool) serveGeneration(w http.ResponseWriter, r *http.Request, group *Group) {
+	gen, err := strconv.ParseUint(r.URL.Query().Get("gen"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad gen: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.observeGeneration(gen)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *HTTPPool) serveBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, group *Group) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, keys, err := decodeBatchRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if name != group.Name() {
+		http.Error(w, "batch for group "+name+" sent to "+group.Name(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := group.serveBatch(group.extractHTTPTrace(ctx, r.Header), keys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(encodeBatchResponse(results))
+}
+
+type httpGetter struct {
+	transport func(context.Context) http.RoundTripper
+	baseURL   string
+	health    *peerHealth
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func (h *httpGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	return h.health.call(ctx, func() error { return h.get(ctx, in, out) })
+}
+
+func (h *httpGetter) peerName() string { return h.baseURL }
+
+// Set stores a value in the peer's main cache with a PUT request.
+func (h *httpGetter) Set(ctx context.Context, group, key string, value []byte, expire time.Time) error {
+	u := h.keyURL(group, key)
+	if !expire.IsZero() {
+		u += "?expire=" + strconv.FormatInt(expire.UnixNano(), 10)
+	}
+	return h.update(ctx, "PUT", u, value)
+}
+
+// PushHot stores a value in the peer's hot cache with a PUT request.
+func (h *httpGetter) PushHot(ctx context.Context, group, key string, gen uint64, value []byte, expire time.Time) error {
+	u := h.keyURL(group, key) + "?hot=1&gen=" + strconv.FormatUint(gen, 10)
+	if !expire.IsZero() {
+		u += "&expire=" + strconv.FormatInt(expire.UnixNano(), 10)
+	}
+	return h.update(ctx, "PUT", u, value)
+}
+
+// Remove drops a key from the peer's caches with a DELETE request.
+func (h *httpGetter) Remove(ctx context.Context, group, key string) error {
+	return h.update(ctx, "DELETE", h.keyURL(group, key), nil)
+}
+
+// SetGeneration raises the peer's generation of group with a PUT request.
+func (h *httpGetter) SetGeneration(ctx context.Context, group string, gen uint64) error {
+	u := h.baseURL + url.PathEscape(group) + "?gen=" + strconv.FormatUint(gen, 10)
+	return h.update(ctx, "PUT", u, nil)
+}
+
+func (h *httpGetter) keyURL(group, key string) string {
+	return h.baseURL + url.PathEscape(group) + "/" + url.PathEscape(key)
+}
+
+func (h *httpGetter) update(ctx context.Context, method, u string, body []byte) error {
+	return h.health.call(ctx, func() error { return h.doUpdate(ctx, method, u, body) })
+}
+
+func (h *httpGetter) doUpdate(ctx context.Context, method, u string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	tr := http.DefaultTransport
+	if h.transport != nil {
+		tr = h.transport(ctx)
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// GetBatch fetches many keys of a group with one POST request.
+func (h *httpGetter) GetBatch(ctx context.Context, group string, keys []string) ([]BatchResult, error) {
+	var results []BatchResult
+	err := h.health.call(ctx, func() (err error) {
+		results, err = h.getBatch(ctx, group, keys)
+		return err
+	})
+	return results, err
+}
+
+func (h *httpGetter) getBatch(ctx context.Context, group string, keys []string) ([]BatchResult, error) {
+	u := h.baseURL + url.PathEscape(group) + "/"
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(encodeBatchRequest(group, keys)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range traceHeaders(ctx) {
+		req.Header.Set(k, v)
+	}
+	tr := http.DefaultTransport
+	if h.transport != nil {
+		tr = h.transport(ctx)
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned: %v", res.Status)
+	}
+
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	defer bufferPool.Put(b)
+	_, err = io.Copy(b, res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	results, err := decodeBatchResponse(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("decoding response body: %v", err)
+	}
+	return results, nil
+}
+
+func (h *httpGetter) get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	u := h.keyURL(in.GetGroup(), in.GetKey())
+	q := url.Values{}
+	if gen := generationOf(in.XXX_unrecognized); gen != 0 {
+		q.Set("gen", strconv.FormatUint(gen, 10))
+	}
+	// 对方可以用这种格式压缩返回的值
+	if name, ok := compressionOf(in.XXX_unrecognized); ok {
+		q.Set("z", name)
+	}
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range traceHeaders(ctx) {
+		req.Header.Set(k, v)
+	}
+	tr := http.DefaultTransport
+	if h.transport != nil {
+		tr = h.transport(ctx)
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	defer bufferPool.Put(b)
+	_, err = io.Copy(b, res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	err = proto.Unmarshal(b.Bytes(), out)
+	if err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	return nil
+}
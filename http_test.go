@@ -0,0 +1,122 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/gcache/singleflight"
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+func TestHTTPPoolPickPeer(t *testing.T) {
+	p := newHTTPPool("http://self:8000", nil)
+	if _, ok := p.PickPeer("key"); ok {
+		t.Fatal("PickPeer on an empty pool returned a peer")
+	}
+
+	p.Set("http://self:8000")
+	if _, ok := p.PickPeer("key"); ok {
+		t.Fatal("PickPeer returned a peer for a key owned by self")
+	}
+
+	p.Set("http://other:8000")
+	peer, ok := p.PickPeer("key")
+	if !ok {
+		t.Fatal("PickPeer found no peer after Set")
+	}
+	if got, want := peer.(*httpGetter).baseURL, "http://other:8000"+defaultBasePath; got != want {
+		t.Errorf("picked %q; want %q", got, want)
+	}
+}
+
+func TestHTTPPoolGetFromPeer(t *testing.T) {
+	const name = "http-pool-test"
+	reg := newTestRegistry(t)
+
+	// 远程节点 也就是 key 的拥有者
+	owner := newHTTPPool("", &HTTPPoolOptions{Registry: reg})
+	ts := httptest.NewServer(owner)
+	defer ts.Close()
+
+	// 两个 group 在同一个进程中 用 peers 参数区分
+	// 服务端的 group 注册在 reg 里 供 ServeHTTP 查找
+	reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner:" + key)
+	}), NoPeers{})
+
+	client := newHTTPPool("http://client", nil)
+	client.Set(ts.URL)
+	g := &Group{
+		name:       name,
+		getter:     GetterFunc(func(_ context.Context, key string, dest Sink) error { return dest.SetString("local:" + key) }),
+		peers:      client,
+		cacheBytes: 1 << 20,
+		loadGroup:  &singleflight.Group{},
+	}
+
+	var s string
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "owner:k" {
+		t.Errorf("Get = %q; want %q", s, "owner:k")
+	}
+	if got := g.Stats.PeerLoads.Get(); got != 1 {
+		t.Errorf("PeerLoads = %d; want 1", got)
+	}
+
+	// 节点下线 退回本地加载
+	ts.Close()
+	if err := g.Get(context.TODO(), "other", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, "local:") {
+		t.Errorf("Get with dead peer = %q; want local load", s)
+	}
+	if got := g.Stats.PeerErrors.Get(); got != 1 {
+		t.Errorf("PeerErrors = %d; want 1", got)
+	}
+}
+
+func TestHTTPPoolKeyEscaping(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	owner := r.NewGroup("esc group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner:" + key)
+	}), NoPeers{})
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: r}))
+	defer ts.Close()
+
+	client := newHTTPPool("http://client", nil)
+	client.Set(ts.URL)
+	ctx := context.TODO()
+	for _, key := range []string{"a b", "a+b", "a/b", "a%2Fb", "100%", "?x=1#y"} {
+		peer, _ := client.PickPeer(key)
+		h := peer.(*httpGetter)
+		group := owner.Name()
+		res := &pb.GetResponse{}
+		if err := h.Get(ctx, &pb.GetRequest{Group: &group, Key: &key}, res); err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if got, want := string(res.Value), "owner:"+key; got != want {
+			t.Errorf("Get(%q) = %q; want %q", key, got, want)
+		}
+
+		if err := h.Set(ctx, group, key, []byte("set"), time.Time{}); err != nil {
+			t.Fatalf("Set(%q): %v", key, err)
+		}
+		var s string
+		if err := owner.Get(ctx, key, StringSink(&s)); err != nil || s != "set" {
+			t.Errorf("after Set(%q) owner has %q, %v; want %q", key, s, err, "set")
+		}
+		if err := h.Remove(ctx, group, key); err != nil {
+			t.Fatalf("Remove(%q): %v", key, err)
+		}
+		if err := owner.Get(ctx, key, StringSink(&s)); err != nil || s != "owner:"+key {
+			t.Errorf("after Remove(%q) owner has %q, %v; want a reload", key, s, err)
+		}
+	}
+}
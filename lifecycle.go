@@ -0,0 +1,77 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrGroupClosed is returned by the Gets of a closed group.
+var ErrGroupClosed = errors.New("groupcache: group closed")
+
+// DeregisterGroup closes the group named name and removes it from the
+// default registry, so a new group of that name can be created. It reports
+// whether such a group existed.
+func DeregisterGroup(name string) bool {
+	return defaultRegistry.DeregisterGroup(name)
+}
+
+// Close removes the group from the registry, stops its background
+// refreshes and hot key pushes, waits for them to return and drops every
+// cached value. Gets of a closed group fail with ErrGroupClosed. Close
+// always returns nil; it is an error so a Group is an io.Closer.
+func (g *Group) Close() error {
+	if g.closed.Swap(true) {
+		return nil
+	}
+
+	g.reg().remove(g)
+	g.bg.stop()
+	g.mainCache.clear()
+	g.hotCache.clear()
+	g.missCache.clear()
+	g.hot.clear()
+	return nil
+}
+
+// background runs the goroutines a group starts on its own, so Close can
+// stop them.
+type background struct {
+	mu     sync.Mutex
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// start runs fn in a goroutine with a context that is cancelled by stop.
+// It reports false, without running fn, once the group is closed.
+func (b *background) start(fn func(ctx context.Context)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return false
+	}
+	if b.ctx == nil {
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+	}
+	ctx := b.ctx
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(ctx)
+	}()
+	return true
+}
+
+// stop cancels the running goroutines and waits for them.
+func (b *background) stop() {
+	b.mu.Lock()
+	b.closed = true
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
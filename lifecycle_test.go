@@ -0,0 +1,145 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestRegistry returns a registry of its own for one test and closes
+// its groups when the test ends, so parallel tests and repeated runs do
+// not collide on the default registry.
+func newTestRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestCloseGroup(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	g := r.NewGroup("g", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), NoPeers{})
+	var s string
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r.GetGroup(g.Name()) != nil {
+		t.Error("closed group still registered")
+	}
+	if st := g.CacheStats(MainCache); st.Bytes != 0 || st.Items != 0 {
+		t.Errorf("main cache after Close = %+v; want empty", st)
+	}
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); !errors.Is(err, ErrGroupClosed) {
+		t.Errorf("Get after Close = %v; want ErrGroupClosed", err)
+	}
+	if err := g.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+
+	// 关闭后可以重新创建同名的 group
+	again := r.NewGroup(g.Name(), 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("again")
+	}), NoPeers{})
+	if r.GetGroup(g.Name()) != again {
+		t.Error("re-created group not registered")
+	}
+	// 旧 group 的 Close 不能删除新 group
+	g.Close()
+	if r.GetGroup(g.Name()) != again {
+		t.Error("Close of the old group removed the new one")
+	}
+}
+
+func TestDeregisterGroup(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	g := r.NewGroup("g", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return nil
+	}), NoPeers{})
+
+	if !r.DeregisterGroup(g.Name()) {
+		t.Fatal("DeregisterGroup = false for a registered group")
+	}
+	if r.DeregisterGroup(g.Name()) {
+		t.Error("DeregisterGroup = true for a removed group")
+	}
+	if !g.closed.Load() {
+		t.Error("deregistered group not closed")
+	}
+}
+
+func TestCloseStopsBackgroundRefresh(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	started := make(chan struct{})
+	var loads atomic.Int32
+	g := r.NewGroup("g", 1<<20, GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		if loads.Add(1) > 1 {
+			// 后台刷新 一直等到 Close 取消
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return dest.SetString("v")
+	}), NoPeers{})
+	g.SetRefreshOptions(RefreshOptions{TTL: time.Millisecond, StaleFor: time.Hour})
+
+	var s string
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	go g.Get(context.TODO(), "k", StringSink(new(string)))
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		g.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not stop the background refresh")
+	}
+	if n := g.Stats.BackgroundRefreshErrs.Get(); n != 1 {
+		t.Errorf("BackgroundRefreshErrs = %d; want 1", n)
+	}
+}
+
+func TestRegistryClose(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry()
+	getter := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	})
+	a := r.NewGroup("a", 1<<20, getter, NoPeers{})
+	b := r.NewGroup("b", 1<<20, getter, NoPeers{})
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []*Group{a, b} {
+		if r.GetGroup(g.Name()) != nil {
+			t.Errorf("group %s still registered after Close", g.Name())
+		}
+		if err := g.Get(context.TODO(), "k", StringSink(new(string))); !errors.Is(err, ErrGroupClosed) {
+			t.Errorf("Get of %s after Close = %v; want ErrGroupClosed", g.Name(), err)
+		}
+	}
+
+	// 关闭后的 registry 仍然可以用
+	c := r.NewGroup("a", 1<<20, getter, NoPeers{})
+	defer r.Close()
+	if r.GetGroup("a") != c {
+		t.Error("group created after Close not registered")
+	}
+}
@@ -0,0 +1,167 @@
+package groupcache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// statsMetrics maps the Stats counters to Prometheus metric names.
+var statsMetrics = []struct {
+	name  string
+	help  string
+	field func(*Stats) *AtomicInt
+}{
+	{"gets_total", "Get requests, including requests from peers.", func(s *Stats) *AtomicInt { return &s.Gets }},
+	{"cache_hits_total", "Gets served from the main or hot cache.", func(s *Stats) *AtomicInt { return &s.CacheHits }},
+	{"peer_loads_total", "Values loaded from a peer.", func(s *Stats) *AtomicInt { return &s.PeerLoads }},
+	{"peer_errors_total", "Failed loads from a peer.", func(s *Stats) *AtomicInt { return &s.PeerErrors }},
+	{"loads_total", "Gets that missed the cache.", func(s *Stats) *AtomicInt { return &s.Loads }},
+	{"loads_deduped_total", "Loads left after singleflight deduplication.", func(s *Stats) *AtomicInt { return &s.LoadsDeduped }},
+	{"local_loads_total", "Values loaded by the Getter.", func(s *Stats) *AtomicInt { return &s.LocalLoads }},
+	{"local_load_errors_total", "Failed Getter calls.", func(s *Stats) *AtomicInt { return &s.LocalLoadErrs }},
+	{"server_requests_total", "Requests received from peers.", func(s *Stats) *AtomicInt { return &s.ServerRequests }},
+	{"stale_hits_total", "Expired values served during their stale window.", func(s *Stats) *AtomicInt { return &s.StaleHits }},
+	{"background_refreshes_total", "Background refreshes started.", func(s *Stats) *AtomicInt { return &s.BackgroundRefreshes }},
+	{"background_refresh_errors_total", "Failed background refreshes.", func(s *Stats) *AtomicInt { return &s.BackgroundRefreshErrs }},
+	{"not_found_loads_total", "Loads that found no value.", func(s *Stats) *AtomicInt { return &s.NotFoundLoads }},
+	{"not_found_hits_total", "Gets served from the negative cache.", func(s *Stats) *AtomicInt { return &s.NotFoundHits }},
+	{"hot_pushes_total", "Hot keys pushed to peers.", func(s *Stats) *AtomicInt { return &s.HotPushes }},
+	{"hot_push_errors_total", "Failed pushes of a hot key to a peer.", func(s *Stats) *AtomicInt { return &s.HotPushErrs }},
+}
+
+// cacheMetrics are reported per cache with a cache label.
+var cacheMetrics = []struct {
+	name string
+	typ  string
+	help string
+	get  func(CacheStats) int64
+}{
+	{"cache_bytes", "gauge", "Bytes of keys and values in the cache.", func(s CacheStats) int64 { return s.Bytes }},
+	{"cache_items", "gauge", "Entries in the cache.", func(s CacheStats) int64 { return s.Items }},
+	{"cache_gets_total", "counter", "Lookups in the cache.", func(s CacheStats) int64 { return s.Gets }},
+	{"cache_lookup_hits_total", "counter", "Lookups that found a value.", func(s CacheStats) int64 { return s.Hits }},
+	{"cache_evictions_total", "counter", "Entries evicted to make room.", func(s CacheStats) int64 { return s.Evictions }},
+}
+
+// latencyMetrics are reported as histograms in seconds.
+var latencyMetrics = []struct {
+	name  string
+	help  string
+	field func(*Stats) *Histogram
+}{
+	{"get_latency_seconds", "Latency of Group.Get.", func(s *Stats) *Histogram { return &s.GetLatency }},
+	{"local_load_latency_seconds", "Latency of Getter calls.", func(s *Stats) *Histogram { return &s.LocalLoadLatency }},
+	{"peer_load_latency_seconds", "Latency of peer requests.", func(s *Stats) *Histogram { return &s.PeerLoadLatency }},
+}
+
+// MetricsHandler returns an http.Handler that writes the Stats and cache
+// sizes of every group of the default registry in the Prometheus text exposition
+// format. Metric names start with "groupcache_" and have a group label.
+func MetricsHandler() http.Handler {
+	return defaultRegistry.MetricsHandler()
+}
+
+func serveMetrics(w http.ResponseWriter, list []*Group) {
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	writeMetrics(bw, list)
+	bw.Flush()
+}
+
+func writeMetrics(w io.Writer, list []*Group) {
+	for _, m := range statsMetrics {
+		writeHeader(w, m.name, "counter", m.help)
+		for _, g := range list {
+			fmt.Fprintf(w, "groupcache_%s{group=\"%s\"} %d\n", m.name, escapeLabel(g.name), m.field(&g.Stats).Get())
+		}
+	}
+
+	// 每个缓存只取一次快照 同一次输出里的数值互相一致
+	stats := make([][]CacheStats, len(list))
+	for i, g := range list {
+		for _, c := range cacheTypes {
+			stats[i] = append(stats[i], g.CacheStats(c.which))
+		}
+	}
+	for _, m := range cacheMetrics {
+		writeHeader(w, m.name, m.typ, m.help)
+		for i, g := range list {
+			for j, c := range cacheTypes {
+				fmt.Fprintf(w, "groupcache_%s{group=\"%s\",cache=\"%s\"} %d\n", m.name, escapeLabel(g.name), c.name, m.get(stats[i][j]))
+			}
+		}
+	}
+
+	for _, m := range latencyMetrics {
+		writeHeader(w, m.name, "histogram", m.help)
+		for _, g := range list {
+			writeHistogram(w, m.name, fmt.Sprintf("group=\"%s\"", escapeLabel(g.name)), m.field(&g.Stats).Snapshot())
+		}
+	}
+
+	writeHeader(w, "peer_latency_seconds", "histogram", "Latency of requests to each peer.")
+	for _, g := range list {
+		peers := g.Stats.PeerLatencies()
+		names := make([]string, 0, len(peers))
+		for name := range peers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			labels := fmt.Sprintf("group=\"%s\",peer=\"%s\"", escapeLabel(g.name), escapeLabel(name))
+			writeHistogram(w, "peer_latency_seconds", labels, peers[name])
+		}
+	}
+
+	writeHeader(w, "hit_ratio", "gauge", "Cache hits per Get since the group was created.")
+	for _, g := range list {
+		var ratio float64
+		if gets := g.Stats.Gets.Get(); gets > 0 {
+			ratio = float64(g.Stats.CacheHits.Get()) / float64(gets)
+		}
+		fmt.Fprintf(w, "groupcache_hit_ratio{group=\"%s\"} %g\n", escapeLabel(g.name), ratio)
+	}
+}
+
+// writeHistogram writes the cumulative buckets, sum and count of s.
+func writeHistogram(w io.Writer, name, labels string, s HistogramSnapshot) {
+	var n int64
+	for i, b := range s.Buckets {
+		n += b.Count
+		le := "+Inf"
+		if i < len(s.Buckets)-1 {
+			le = strconv.FormatFloat(b.UpperBound.Seconds(), 'g', -1, 64)
+		}
+		fmt.Fprintf(w, "groupcache_%s_bucket{%s,le=\"%s\"} %d\n", name, labels, le, n)
+	}
+	fmt.Fprintf(w, "groupcache_%s_sum{%s} %g\n", name, labels, s.Sum.Seconds())
+	fmt.Fprintf(w, "groupcache_%s_count{%s} %d\n", name, labels, n)
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP groupcache_%s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE groupcache_%s %s\n", name, typ)
+}
+
+// cacheTypes are the caches of a group with their label values.
+var cacheTypes = []struct {
+	name  string
+	which CacheType
+}{
+	{"main", MainCache},
+	{"hot", HotCache},
+	{"miss", MissCache},
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,112 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	reg := newTestRegistry(t)
+	g := reg.NewGroup(`metrics "test"`, 50, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(strings.Repeat("x", 20))
+	}), NoPeers{})
+	ctx := context.TODO()
+	var s string
+	for _, key := range []string{"a", "b", "c", "a"} {
+		g.Get(ctx, key, StringSink(&s))
+	}
+
+	rec := httptest.NewRecorder()
+	reg.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE groupcache_gets_total counter\n",
+		`groupcache_gets_total{group="metrics \"test\""} 4` + "\n",
+		`groupcache_local_loads_total{group="metrics \"test\""} 4` + "\n",
+		`groupcache_cache_items{group="metrics \"test\"",cache="main"} 2` + "\n",
+		`groupcache_cache_bytes{group="metrics \"test\"",cache="main"} 42` + "\n",
+		`groupcache_cache_evictions_total{group="metrics \"test\"",cache="main"} 2` + "\n",
+		`groupcache_hit_ratio{group="metrics \"test\""} 0` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestMetricsCoverStats(t *testing.T) {
+	var stats Stats
+	exported := make(map[interface{}]bool)
+	for _, m := range statsMetrics {
+		exported[m.field(&stats)] = true
+	}
+	for _, m := range latencyMetrics {
+		exported[m.field(&stats)] = true
+	}
+	v := reflect.ValueOf(&stats).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		if f := v.Field(i).Addr().Interface(); !exported[f] {
+			t.Errorf("Stats.%s is not exported as a metric", v.Type().Field(i).Name)
+		}
+	}
+}
+
+// TestMetricsFamilies parses the exposition output and checks that every
+// family is declared once and its samples are not split up.
+func TestMetricsFamilies(t *testing.T) {
+	reg := newTestRegistry(t)
+	g := reg.NewGroup("metrics-families", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), NoPeers{})
+	var s string
+	g.Get(context.TODO(), "a", StringSink(&s))
+
+	rec := httptest.NewRecorder()
+	reg.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	types := make(map[string]string)
+	done := make(map[string]bool)
+	var cur string
+	for _, line := range strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n") {
+		if f := strings.Fields(line); len(f) == 4 && f[0] == "#" && f[1] == "TYPE" {
+			if _, ok := types[f[2]]; ok {
+				t.Errorf("family %s declared twice", f[2])
+			}
+			types[f[2]] = f[3]
+			done[cur] = true
+			cur = f[2]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, _, _ := strings.Cut(line, "{")
+		family := name
+		if types[cur] == "histogram" {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if base, ok := strings.CutSuffix(name, suffix); ok && base == cur {
+					family = base
+				}
+			}
+		}
+		if family != cur {
+			t.Errorf("sample %q outside its family %s", line, cur)
+		}
+		if done[family] {
+			t.Errorf("family %s continues after another family", family)
+		}
+	}
+	if len(types) == 0 {
+		t.Fatal("no metric families")
+	}
+}
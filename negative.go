@@ -0,0 +1,86 @@
+package groupcache
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrNotFound is returned by a Getter, wrapped or not, for a key that
+// does not exist. With SetNotFoundTTL the group remembers it and answers
+// later Gets of the key with ErrNotFound without calling the Getter.
+var ErrNotFound = errors.New("groupcache: not found")
+
+// SetNotFoundTTL makes the group cache ErrNotFound results of its Getter
+// for d. Peers that load the key from this process cache the answer
+// until the same time. Zero, the default, disables negative caching.
+// It must be called before the group serves its first Get.
+func (g *Group) SetNotFoundTTL(d time.Duration) {
+	g.notFoundTTL = d
+}
+
+// lookupNotFound reports whether key is cached as not found.
+func (g *Group) lookupNotFound(key cacheKey) bool {
+	if g.cacheBytes <= 0 {
+		return false
+	}
+	_, ok := g.missCache.getAt(key, g.now())
+	return ok
+}
+
+// notFoundExpire returns when the negative entry of key expires, or the
+// zero time if it is not cached.
+func (g *Group) notFoundExpire(key string) time.Time {
+	v, ok := g.missCache.getAt(g.cacheKey(key), g.now())
+	if !ok {
+		return time.Time{}
+	}
+	return v.e
+}
+
+// notFoundError is ErrNotFound as reported by a peer, with the time until
+// which the peer's answer may be cached.
+type notFoundError struct {
+	expire time.Time
+}
+
+func (e *notFoundError) Error() string { return ErrNotFound.Error() }
+func (e *notFoundError) Unwrap() error { return ErrNotFound }
+
+// A peer answers a Get of a missing key with an empty GetResponse that
+// has field 14 set to the expiry of its negative entry, in Unix
+// nanoseconds, or to 0 if the answer should not be cached:
+//
+//	message GetResponse {
+//	  ...
+//	  int64 not_found = 14;
+//	}
+const notFoundField = 14
+
+// notFoundResponse is the response to a peer's Get of a missing key.
+func (g *Group) notFoundResponse(key string) *pb.GetResponse {
+	var expire uint64
+	if e := g.notFoundExpire(key); !e.IsZero() {
+		expire = uint64(e.UnixNano())
+	}
+	b := appendGeneration(nil, g.Generation())
+	b = protowire.AppendTag(b, notFoundField, protowire.VarintType)
+	b = protowire.AppendVarint(b, expire)
+	return &pb.GetResponse{XXX_unrecognized: b}
+}
+
+// notFoundOf returns the error a peer's response stands for, if it is a
+// not found answer.
+func notFoundOf(res *pb.GetResponse) error {
+	ns, ok := varintField(res.XXX_unrecognized, notFoundField)
+	if !ok {
+		return nil
+	}
+	var expire time.Time
+	if ns != 0 {
+		expire = time.Unix(0, int64(ns))
+	}
+	return &notFoundError{expire: expire}
+}
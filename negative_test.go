@@ -0,0 +1,155 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNotFoundCached(t *testing.T) {
+	var loads atomic.Int32
+	g := newTestGroup("not-found-cached", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads.Add(1)
+		return fmt.Errorf("no row %s: %w", key, ErrNotFound)
+	}), NoPeers{})
+	g.SetNotFoundTTL(20 * time.Millisecond)
+	ctx := context.TODO()
+
+	var s string
+	for i := 0; i < 3; i++ {
+		if err := g.Get(ctx, "k", StringSink(&s)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get = %v; want ErrNotFound", err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("Getter called %d times; want 1", n)
+	}
+	if n := g.Stats.NotFoundLoads.Get(); n != 1 {
+		t.Errorf("NotFoundLoads = %d; want 1", n)
+	}
+	if n := g.Stats.NotFoundHits.Get(); n != 2 {
+		t.Errorf("NotFoundHits = %d; want 2", n)
+	}
+	if n := g.Stats.LocalLoadErrs.Get(); n != 0 {
+		t.Errorf("LocalLoadErrs = %d; want 0", n)
+	}
+
+	// 过期后重新加载
+	time.Sleep(30 * time.Millisecond)
+	g.Get(ctx, "k", StringSink(&s))
+	if n := loads.Load(); n != 2 {
+		t.Errorf("Getter called %d times after expiry; want 2", n)
+	}
+
+	// Set 覆盖不存在的记录
+	if err := g.Set(ctx, "k", []byte("v"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "v" {
+		t.Errorf("Get after Set = %q, %v; want %q", s, err, "v")
+	}
+}
+
+func TestNotFoundNotCachedByDefault(t *testing.T) {
+	var loads atomic.Int32
+	g := newTestGroup("not-found-default", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads.Add(1)
+		return ErrNotFound
+	}), NoPeers{})
+
+	var s string
+	for i := 0; i < 3; i++ {
+		g.Get(context.TODO(), "k", StringSink(&s))
+	}
+	if n := loads.Load(); n != 3 {
+		t.Errorf("Getter called %d times; want 3", n)
+	}
+}
+
+func TestNotFoundFromHTTPPeer(t *testing.T) {
+	const name = "not-found-http"
+	reg := newTestRegistry(t)
+
+	var ownerLoads atomic.Int32
+	owner := reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		ownerLoads.Add(1)
+		return ErrNotFound
+	}), NoPeers{})
+	owner.SetNotFoundTTL(time.Hour)
+
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: reg}))
+	defer ts.Close()
+	pool := newHTTPPool("http://self", nil)
+	pool.Set(ts.URL)
+
+	var localLoads atomic.Int32
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		localLoads.Add(1)
+		return dest.SetString("local")
+	}), pool)
+
+	var s string
+	for i := 0; i < 2; i++ {
+		if err := g.Get(context.TODO(), "k", StringSink(&s)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get = %q, %v; want ErrNotFound", s, err)
+		}
+	}
+	if n := ownerLoads.Load(); n != 1 {
+		t.Errorf("owner Getter called %d times; want 1", n)
+	}
+	if n := localLoads.Load(); n != 0 {
+		t.Errorf("fell back to the local Getter %d times", n)
+	}
+	if n := g.Stats.NotFoundHits.Get(); n != 1 {
+		t.Errorf("NotFoundHits = %d; want 1", n)
+	}
+	if n := g.Stats.PeerErrors.Get(); n != 0 {
+		t.Errorf("PeerErrors = %d; want 0", n)
+	}
+}
+
+func TestNotFoundFromBatchPeer(t *testing.T) {
+	r := newTestRegistry(t)
+	var ownerLoads atomic.Int32
+	owner := r.NewGroup("not-found-batch", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		ownerLoads.Add(1)
+		if key == "missing" {
+			return ErrNotFound
+		}
+		return dest.SetString("owner:" + key)
+	}), NoPeers{})
+	owner.SetNotFoundTTL(time.Hour)
+
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: r}))
+	defer ts.Close()
+
+	var localLoads atomic.Int32
+	g := newTestGroup(owner.Name(), GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		localLoads.Add(1)
+		return dest.SetString("local")
+	}), keyPicker{peer: &httpGetter{baseURL: ts.URL + defaultBasePath}})
+
+	for i := 0; i < 2; i++ {
+		values, err := getMultiStrings(g, []string{"k", "missing"})
+		var errs MultiError
+		if !errors.As(err, &errs) || errs[0] != nil || !errors.Is(errs[1], ErrNotFound) {
+			t.Fatalf("GetMulti = %q, %v; want ErrNotFound for the second key", values, err)
+		}
+	}
+	if n := ownerLoads.Load(); n != 2 {
+		t.Errorf("owner Getter called %d times; want 2", n)
+	}
+	if n := localLoads.Load(); n != 0 {
+		t.Errorf("fell back to the local Getter %d times", n)
+	}
+	if n := g.Stats.NotFoundHits.Get(); n != 1 {
+		t.Errorf("NotFoundHits = %d; want 1, from the cached answer", n)
+	}
+	if n := g.Stats.PeerErrors.Get(); n != 0 {
+		t.Errorf("PeerErrors = %d; want 0", n)
+	}
+}
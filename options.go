@@ -0,0 +1,260 @@
+package groupcache
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	cachepolicy "example.com/gcache/cache_policy"
+	"example.com/gcache/singleflight"
+)
+
+// GroupOption configures a group made by NewGroupWithOptions.
+type GroupOption func(*groupConfig)
+
+type groupConfig struct {
+	cacheBytes  int64
+	hotFraction float64
+	hotSet      bool
+	policy      EvictionPolicy
+	policySet   bool
+	peers       PeerPicker
+	loadGroup   FlightGroup
+	flightSet   bool
+	clock       Clock
+	clockSet    bool
+	rand        *rand.Rand
+
+	compression    CompressionOptions
+	compressionSet bool
+}
+
+// EvictionPolicy makes the empty policy of one of a group's caches. The
+// policy must call onEvicted for every entry it removes, and must not
+// evict on its own; the group evicts with RemoveOldest when its caches
+// are over budget.
+type EvictionPolicy func(onEvicted func(key cachepolicy.Key, value interface{})) cachepolicy.Policy
+
+// LRU is the default EvictionPolicy: the least recently used entry is
+// evicted first.
+func LRU(onEvicted func(key cachepolicy.Key, value interface{})) cachepolicy.Policy {
+	c := cachepolicy.LRUNew(0)
+	c.OnEvcted = onEvicted
+	return c
+}
+
+// SlabLRU is an EvictionPolicy like LRU that keeps its entries in a few
+// large slabs and copies keys and values into large byte chunks, so a
+// cache of millions of small values holds nothing the GC has to scan
+// per entry. Values read from it point into those chunks instead of
+// being copied.
+func SlabLRU(onEvicted func(key cachepolicy.Key, value interface{})) cachepolicy.Policy {
+	c := newSlabLRU()
+	if onEvicted != nil {
+		c.onEvicted = func(key []byte, gen uint64, value ByteView) {
+			onEvicted(cacheKey{key: string(key), gen: gen}, value)
+		}
+	}
+	return c
+}
+
+// Clock tells a group the time. It decides when entries expire, when
+// they are refreshed and how hot keys are, and measures the latencies in
+// Stats, so tests with a fake clock need not sleep.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock of time.Now.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// WithCacheBytes limits the bytes of keys and values the group caches.
+// Without it, or with 0, the group caches nothing.
+func WithCacheBytes(n int64) GroupOption {
+	return func(c *groupConfig) {
+		c.cacheBytes = n
+	}
+}
+
+// WithHotCacheFraction lets the hot cache, which holds values owned by
+// other peers, grow to f times the bytes of the main cache before it is
+// evicted first. The default is 1/8.
+func WithHotCacheFraction(f float64) GroupOption {
+	return func(c *groupConfig) {
+		c.hotFraction, c.hotSet = f, true
+	}
+}
+
+// WithEvictionPolicy makes the group's caches with p instead of LRU.
+func WithEvictionPolicy(p EvictionPolicy) GroupOption {
+	return func(c *groupConfig) {
+		c.policy, c.policySet = p, true
+	}
+}
+
+// WithPeers makes the group pick peers with p instead of the peer picker
+// registered with its registry.
+func WithPeers(p PeerPicker) GroupOption {
+	return func(c *groupConfig) {
+		c.peers = p
+	}
+}
+
+// WithSingleflight deduplicates the group's loads with f instead of a
+// singleflight.Group.
+func WithSingleflight(f FlightGroup) GroupOption {
+	return func(c *groupConfig) {
+		c.loadGroup, c.flightSet = f, true
+	}
+}
+
+// WithClock makes the group read the time from clk, including when its
+// cached values expire. Peer breakers take theirs from
+// HealthOptions.Clock.
+func WithClock(clk Clock) GroupOption {
+	return func(c *groupConfig) {
+		c.clock, c.clockSet = clk, true
+	}
+}
+
+// validate reports options that are invalid or do not go together.
+func (c *groupConfig) validate() error {
+	switch {
+	case c.cacheBytes < 0:
+		return fmt.Errorf("groupcache: negative cache bytes %d", c.cacheBytes)
+	case c.hotSet && (c.hotFraction <= 0 || c.hotFraction >= 1):
+		return fmt.Errorf("groupcache: hot cache fraction %g not in (0, 1)", c.hotFraction)
+	case c.policySet && c.policy == nil:
+		return errors.New("groupcache: nil eviction policy")
+	case c.flightSet && c.loadGroup == nil:
+		return errors.New("groupcache: nil singleflight group")
+	case c.clockSet && c.clock == nil:
+		return errors.New("groupcache: nil clock")
+	case c.compressionSet && c.compression.Threshold < 0:
+		return fmt.Errorf("groupcache: negative compression threshold %d", c.compression.Threshold)
+	}
+	// 不缓存时这些选项没有作用 多半是配置写错了
+	if c.cacheBytes == 0 {
+		switch {
+		case c.hotSet:
+			return errors.New("groupcache: hot cache fraction set without cache bytes")
+		case c.policySet:
+			return errors.New("groupcache: eviction policy set without cache bytes")
+		case c.compressionSet && !c.compression.Peers:
+			return errors.New("groupcache: compression set without cache bytes or peers")
+		}
+	}
+	return nil
+}
+
+// NewGroupWithOptions creates a group in the default registry. Unlike
+// NewGroup it reports invalid options and duplicate names as errors.
+func NewGroupWithOptions(name string, getter Getter, opts ...GroupOption) (*Group, error) {
+	return defaultRegistry.NewGroupWithOptions(name, getter, opts...)
+}
+
+// NewGroupWithOptions creates a group in r. Unlike NewGroup it reports
+// invalid options and duplicate names as errors.
+func (r *Registry) NewGroupWithOptions(name string, getter Getter, opts ...GroupOption) (*Group, error) {
+	var c groupConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return r.newGroup(name, getter, &c)
+}
+
+// newGroup creates a group configured by c in r.
+func (r *Registry) newGroup(name string, getter Getter, c *groupConfig) (*Group, error) {
+	if getter == nil {
+		return nil, errors.New("groupcache: nil Getter")
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 初始化对等节点服务
+	r.initPeerServerOnce.Do(r.callInitPeerServer)
+
+	if _, dup := r.groups[name]; dup {
+		return nil, errors.New("groupcache: duplicate registration of group " + name)
+	}
+
+	g := &Group{
+		name:        name,
+		getter:      getter,
+		peers:       c.peers,
+		cacheBytes:  c.cacheBytes,
+		loadGroup:   c.loadGroup,
+		hotFraction: c.hotFraction,
+		clock:       c.clock,
+		rand:        c.rand,
+		registry:    r,
+	}
+	if g.loadGroup == nil {
+		g.loadGroup = &singleflight.Group{}
+	}
+	for _, cache := range []*cache{&g.mainCache, &g.hotCache, &g.missCache} {
+		cache.policy = c.policy
+		cache.clock = c.clock
+	}
+	if c.compressionSet {
+		o := c.compression.withDefaults()
+		g.compression = &o
+	}
+
+	for _, fn := range r.newGroupHooks {
+		fn(g)
+	}
+
+	r.groups[name] = g
+	g.emit(Event{Type: EventGroupCreated})
+	return g, nil
+}
+
+// WithRandSeed makes the group's random choices, such as which values go
+// into the hot cache when hot key tracking is off, repeat for the same
+// seed.
+func WithRandSeed(seed int64) GroupOption {
+	return func(c *groupConfig) {
+		c.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// now returns the time of the group's clock.
+func (g *Group) now() time.Time {
+	if g.clock == nil {
+		return time.Now()
+	}
+	return g.clock.Now()
+}
+
+// since is time.Since on the group's clock.
+func (g *Group) since(t time.Time) time.Duration {
+	return g.now().Sub(t)
+}
+
+// intn is rand.Intn on the group's random source.
+func (g *Group) intn(n int) int {
+	if g.rand == nil {
+		return rand.Intn(n)
+	}
+	// rand.Rand 不能并发使用
+	g.randMu.Lock()
+	defer g.randMu.Unlock()
+	return g.rand.Intn(n)
+}
+
+// hotLimit returns how many bytes the hot cache may hold before it is
+// evicted first.
+func (g *Group) hotLimit(mainBytes int64) int64 {
+	if g.hotFraction == 0 {
+		return mainBytes / 8
+	}
+	return int64(float64(mainBytes) * g.hotFraction)
+}
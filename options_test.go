@@ -0,0 +1,143 @@
+package groupcache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cachepolicy "example.com/gcache/cache_policy"
+	"example.com/gcache/groupcachetest"
+)
+
+func TestGroupOptionsValidation(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	getter := GetterFunc(func(_ context.Context, key string, dest Sink) error { return nil })
+	tests := []struct {
+		name string
+		opts []GroupOption
+		err  string // 为空表示合法
+	}{
+		{"defaults", nil, ""},
+		{"all", []GroupOption{WithCacheBytes(1 << 20), WithHotCacheFraction(0.5), WithEvictionPolicy(LRU), WithPeers(NoPeers{}), WithClock(groupcachetest.NewFakeClock(time.Now()))}, ""},
+		{"negative bytes", []GroupOption{WithCacheBytes(-1)}, "negative cache bytes"},
+		{"hot fraction zero", []GroupOption{WithCacheBytes(1), WithHotCacheFraction(0)}, "not in (0, 1)"},
+		{"hot fraction one", []GroupOption{WithCacheBytes(1), WithHotCacheFraction(1)}, "not in (0, 1)"},
+		{"hot without bytes", []GroupOption{WithHotCacheFraction(0.5)}, "without cache bytes"},
+		{"policy without bytes", []GroupOption{WithEvictionPolicy(LRU)}, "without cache bytes"},
+		{"nil policy", []GroupOption{WithCacheBytes(1), WithEvictionPolicy(nil)}, "nil eviction policy"},
+		{"nil singleflight", []GroupOption{WithSingleflight(nil)}, "nil singleflight"},
+		{"nil clock", []GroupOption{WithClock(nil)}, "nil clock"},
+		{"compression for peers", []GroupOption{WithCompression(CompressionOptions{Peers: true})}, ""},
+		{"negative threshold", []GroupOption{WithCacheBytes(1), WithCompression(CompressionOptions{Threshold: -1})}, "negative compression threshold"},
+		{"compression unused", []GroupOption{WithCompression(CompressionOptions{})}, "without cache bytes or peers"},
+	}
+	for _, tt := range tests {
+		g, err := r.NewGroupWithOptions(tt.name, getter, tt.opts...)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: err = %v; want %q", tt.name, err, tt.err)
+		case tt.err != "" && r.GetGroup(tt.name) != nil:
+			t.Errorf("%s: invalid group registered", tt.name)
+		case tt.err == "" && r.GetGroup(tt.name) != g:
+			t.Errorf("%s: group not registered", tt.name)
+		}
+	}
+
+	if _, err := r.NewGroupWithOptions("defaults", getter); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("duplicate name: err = %v", err)
+	}
+	if _, err := r.NewGroupWithOptions("nil getter", nil); err == nil {
+		t.Error("nil Getter accepted")
+	}
+}
+
+// countingFlight counts the loads it runs.
+type countingFlight struct {
+	n atomic.Int32
+}
+
+func (f *countingFlight) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	f.n.Add(1)
+	return fn()
+}
+
+func TestGroupOptionsApplied(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	var made atomic.Int32
+	policy := func(onEvicted func(key cachepolicy.Key, value interface{})) cachepolicy.Policy {
+		made.Add(1)
+		return LRU(onEvicted)
+	}
+	clk := groupcachetest.NewFakeClock(time.Unix(0, 0))
+	flight := &countingFlight{}
+	g, err := r.NewGroupWithOptions("g", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}),
+		WithCacheBytes(1<<20),
+		WithHotCacheFraction(0.5),
+		WithEvictionPolicy(policy),
+		WithPeers(NoPeers{}),
+		WithSingleflight(flight),
+		WithClock(clk),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetRefreshOptions(RefreshOptions{TTL: time.Minute})
+
+	var s string
+	for i := 0; i < 2; i++ {
+		if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := flight.n.Load(); n != 1 {
+		t.Errorf("singleflight ran %d loads; want 1", n)
+	}
+	if n := made.Load(); n != 1 {
+		t.Errorf("eviction policy made %d caches; want 1", n)
+	}
+	if g.hotLimit(100) != 50 {
+		t.Errorf("hotLimit(100) = %d; want 50", g.hotLimit(100))
+	}
+
+	// 过期时间由 clock 决定
+	clk.Advance(2 * time.Minute)
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if n := flight.n.Load(); n != 2 {
+		t.Errorf("singleflight ran %d loads after the clock passed the TTL; want 2", n)
+	}
+}
+
+func TestSlabLRUPolicy(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	g, err := r.NewGroupWithOptions("g", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("0123456789")
+	}), WithCacheBytes(25), WithEvictionPolicy(SlabLRU), WithPeers(NoPeers{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	for _, key := range []string{"a", "b", "c"} {
+		if err := g.Get(context.TODO(), key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 每个条目 11 字节 只放得下两个 最旧的 a 被淘汰
+	st := g.CacheStats(MainCache)
+	if st.Items != 2 || st.Bytes != 22 || st.Evictions != 1 {
+		t.Errorf("main cache = %+v; want 2 items, 22 bytes, 1 eviction", st)
+	}
+	if _, ok := g.mainCache.get(g.cacheKey("a")); ok {
+		t.Error("oldest key a still cached")
+	}
+}
@@ -2,13 +2,15 @@ package groupcache
 
 import (
 	"context"
+
+	pb "github.com/golang/groupcache/groupcachepb"
 )
 
 type Context = context.Context
 
 // 从其他节点获取数据的标准方法
 type ProtoGetter interface {
-	Get(ctx context.Context, in *pb.GetRequest, out *pb.GetRequest) error
+	Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error
 }
 
 // 节点选择机制
@@ -21,14 +23,12 @@ type NoPeers struct{}
 
 func (NoPeers) PickPeer(key string) (peer ProtoGetter, ok bool) { return }
 
-var (
-	portPicker func(groupName string) PeerPicker
-)
-
 // 注册机制
 func RegisterPeerPicker(fn func() PeerPicker) {
-	if portPicker != nil {
-		panic("RegisterPeerPicker called more than once")
-	}
-	portPicker = func(_ string) PeerPicker ( return fn() )
-}
\ No newline at end of file
+	defaultRegistry.RegisterPeerPicker(fn)
+}
+
+// 每个 group 可以使用不同的 PeerPicker
+func RegisterPerGroupPeerPicker(fn func(groupName string) PeerPicker) {
+	defaultRegistry.RegisterPerGroupPeerPicker(fn)
+}
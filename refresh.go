@@ -0,0 +1,105 @@
+package groupcache
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RefreshOptions configures how a Group treats entries that are about to
+// expire or have just expired.
+type RefreshOptions struct {
+	// TTL, if positive, makes loaded entries expire TTL after they are
+	// loaded. Entries stored with Set keep their own expiry.
+	TTL time.Duration
+
+	// StaleFor keeps serving an expired entry for this long after its
+	// expiry while one background load refreshes it, instead of making
+	// every reader wait for the load.
+	StaleFor time.Duration
+
+	// RefreshAhead reloads an entry in the background when it is read
+	// less than RefreshAhead before its expiry, so keys that keep being
+	// read never expire. Keys nobody reads near their expiry are not
+	// reloaded.
+	RefreshAhead time.Duration
+}
+
+// SetRefreshOptions sets the group's refresh options. It must be called
+// before the group serves its first Get.
+func (g *Group) SetRefreshOptions(o RefreshOptions) {
+	g.refresh = o
+}
+
+// withTTL gives a freshly loaded value the group's TTL. A value that
+// already expires, such as one a peer sent with the owner's expiry,
+// keeps it.
+func (g *Group) withTTL(value ByteView) ByteView {
+	if g.refresh.TTL > 0 && value.e.IsZero() {
+		value.e = g.now().Add(g.refresh.TTL)
+	}
+	return value
+}
+
+// maybeRefresh starts a background load of key if the value served from
+// the cache is stale or about to expire.
+func (g *Group) maybeRefresh(key cacheKey, value ByteView) {
+	if value.e.IsZero() {
+		return
+	}
+	now := g.now()
+	if value.expired(now) {
+		g.Stats.StaleHits.Add(1)
+	} else if g.refresh.RefreshAhead <= 0 || now.Before(value.e.Add(-g.refresh.RefreshAhead)) {
+		return
+	}
+
+	// 每个 key 同时只有一个后台刷新
+	if _, busy := g.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	// 调用方的 ctx 在返回后就会取消 不能用在后台加载里
+	started := g.bg.start(func(ctx context.Context) {
+		defer g.refreshing.Delete(key)
+
+		var b []byte
+		if _, _, err := g.load(ctx, key, AllocatingByteSliceSink(&b), true); err != nil {
+			g.Stats.BackgroundRefreshErrs.Add(1)
+		}
+	})
+	if !started {
+		g.refreshing.Delete(key)
+		return
+	}
+	g.Stats.BackgroundRefreshes.Add(1)
+}
+
+// A peer sends the expiry of the value it serves in field 12 of the
+// GetResponse, in Unix nanoseconds, so the caller's copy expires with the
+// owner's instead of getting a fresh TTL:
+//
+//	message GetResponse {
+//	  ...
+//	  int64 expire = 12;
+//	}
+const expireField = 12
+
+// appendExpire appends the expire field to an encoded message if e is
+// set.
+func appendExpire(b []byte, e time.Time) []byte {
+	if e.IsZero() {
+		return b
+	}
+	b = protowire.AppendTag(b, expireField, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(e.UnixNano()))
+}
+
+// expireOf returns the expire field of an encoded message.
+func expireOf(b []byte) time.Time {
+	ns, ok := varintField(b, expireField)
+	if !ok || ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns))
+}
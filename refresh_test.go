@@ -0,0 +1,167 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/gcache/groupcachetest"
+)
+
+// waitForValue polls g until key has value want.
+func waitForValue(t *testing.T, g *Group, key, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var s string
+		if err := g.Get(context.TODO(), key, StringSink(&s)); err == nil && s == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never became %q", key, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	g := newTestGroup("stale-while-revalidate", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		n := loads.Add(1)
+		if n > 1 {
+			<-release
+		}
+		return dest.SetString("v" + strconv.Itoa(int(n)))
+	}), NoPeers{})
+	g.SetRefreshOptions(RefreshOptions{TTL: 20 * time.Millisecond, StaleFor: time.Hour})
+	ctx := context.TODO()
+
+	var s string
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "v1" {
+		t.Fatalf("Get = %q, %v; want %q", s, err, "v1")
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// 过期后仍然立即返回旧值 只有一个后台刷新
+	for i := 0; i < 3; i++ {
+		if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "v1" {
+			t.Fatalf("stale Get = %q, %v; want %q", s, err, "v1")
+		}
+	}
+	if n := g.Stats.StaleHits.Get(); n != 3 {
+		t.Errorf("StaleHits = %d; want 3", n)
+	}
+	if n := g.Stats.BackgroundRefreshes.Get(); n != 1 {
+		t.Errorf("BackgroundRefreshes = %d; want 1", n)
+	}
+
+	close(release)
+	waitForValue(t, g, "k", "v2")
+}
+
+func TestExpiredWithoutStaleFor(t *testing.T) {
+	var loads atomic.Int32
+	g := newTestGroup("expired-without-stale", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v" + strconv.Itoa(int(loads.Add(1))))
+	}), NoPeers{})
+	g.SetRefreshOptions(RefreshOptions{TTL: 20 * time.Millisecond})
+	ctx := context.TODO()
+
+	var s string
+	g.Get(ctx, "k", StringSink(&s))
+	time.Sleep(30 * time.Millisecond)
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "v2" {
+		t.Fatalf("Get after expiry = %q, %v; want %q", s, err, "v2")
+	}
+	if n := g.Stats.StaleHits.Get(); n != 0 {
+		t.Errorf("StaleHits = %d; want 0", n)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads atomic.Int32
+	g := newTestGroup("refresh-ahead", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v" + strconv.Itoa(int(loads.Add(1))))
+	}), NoPeers{})
+	g.SetRefreshOptions(RefreshOptions{TTL: time.Second, RefreshAhead: 900 * time.Millisecond})
+	ctx := context.TODO()
+
+	var s string
+	for i := 0; i < 2; i++ {
+		if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "v1" {
+			t.Fatalf("Get = %q, %v; want %q", s, err, "v1")
+		}
+	}
+	if n := g.Stats.BackgroundRefreshes.Get(); n != 0 {
+		t.Fatalf("refreshed %d times before the refresh-ahead window", n)
+	}
+
+	// 进入过期前的窗口 读取触发后台刷新
+	time.Sleep(150 * time.Millisecond)
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "v1" {
+		t.Fatalf("Get in window = %q, %v; want %q", s, err, "v1")
+	}
+	waitForValue(t, g, "k", "v2")
+	if n := g.Stats.StaleHits.Get(); n != 0 {
+		t.Errorf("StaleHits = %d; want 0", n)
+	}
+}
+
+func TestPeerValueKeepsOwnerExpiry(t *testing.T) {
+	t.Parallel()
+	clock := groupcachetest.NewFakeClock(time.Unix(1000, 0))
+	r := newTestRegistry(t)
+	owner, err := r.NewGroupWithOptions("expiry", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner:" + key)
+	}), WithCacheBytes(1<<20), WithPeers(NoPeers{}), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner.SetRefreshOptions(RefreshOptions{TTL: time.Hour})
+	setExpire := clock.Now().Add(time.Minute)
+	if err := owner.Set(context.TODO(), "set", []byte("v"), setExpire); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: r}))
+	defer ts.Close()
+
+	g, err := newTestRegistry(t).NewGroupWithOptions("expiry", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), WithCacheBytes(1<<20), WithPeers(keyPicker{peer: &httpGetter{baseURL: ts.URL + defaultBasePath}}), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetRefreshOptions(RefreshOptions{TTL: time.Second})
+
+	// 拥有者的过期时间 而不是本地 TTL 重新计算的
+	want := map[string]time.Time{"set": setExpire, "loaded": clock.Now().Add(time.Hour)}
+	for key, expire := range want {
+		var view ByteView
+		if err := g.Get(context.TODO(), key, ByteViewSink(&view)); err != nil {
+			t.Fatal(err)
+		}
+		if !view.Expire().Equal(expire) {
+			t.Errorf("Get(%q) expires at %v; want the owner's %v", key, view.Expire(), expire)
+		}
+	}
+
+	keys := []string{"set", "loaded", "batch"}
+	views := make([]ByteView, len(keys))
+	dests := make([]Sink, len(keys))
+	for i := range keys {
+		dests[i] = ByteViewSink(&views[i])
+	}
+	if err := g.GetMulti(context.TODO(), keys, dests); err != nil {
+		t.Fatal(err)
+	}
+	want["batch"] = clock.Now().Add(time.Hour)
+	for i, key := range keys {
+		if !views[i].Expire().Equal(want[key]) {
+			t.Errorf("GetMulti(%q) expires at %v; want the owner's %v", key, views[i].Expire(), want[key])
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package groupcache
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Registry owns a set of named groups together with their hooks and peer
+// picker. Groups of different registries never see each other, so one
+// process can host several independent clusters, each with its own pool
+// serving its own registry. The package level functions use
+// DefaultRegistry.
+type Registry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+
+	initPeerServerOnce sync.Once
+
+	// Hook Function 拓展功能
+	newGroupHooks   []func(*Group)
+	serveStartHooks []func()
+
+	portPicker func(groupName string) PeerPicker
+
+	events eventBus
+
+	// 每个 registry 只能有一个 HTTPPool 和一个 GRPCPool
+	httpPoolMade bool
+	grpcPoolMade bool
+}
+
+// NewRegistry returns an empty registry.
+//
+// A registry of its own keeps tests, or configurations that are loaded
+// again, from colliding on the group names of the default registry:
+//
+//	r := groupcache.NewRegistry()
+//	t.Cleanup(func() { r.Close() })
+func NewRegistry() *Registry {
+	return &Registry{groups: make(map[string]*Group)}
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry returns the registry used by the package level
+// functions and by pools created without a Registry option.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// GetGroup returns the group named name, or nil if there is none.
+func (r *Registry) GetGroup(name string) *Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.groups[name]
+}
+
+// NewGroup creates a group in r. It panics if r already has a group
+// named name. If peers is nil the group uses the peer picker registered
+// with r.
+func (r *Registry) NewGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *Group {
+	// 以前负数表示不缓存 保持兼容
+	if cacheBytes < 0 {
+		cacheBytes = 0
+	}
+	g, err := r.newGroup(name, getter, &groupConfig{cacheBytes: cacheBytes, peers: peers})
+	if err != nil {
+		panic(err.Error())
+	}
+	return g
+}
+
+// DeregisterGroup closes the group named name and removes it from r, so
+// a new group of that name can be created. It reports whether such a
+// group existed.
+func (r *Registry) DeregisterGroup(name string) bool {
+	g := r.GetGroup(name)
+	if g == nil {
+		return false
+	}
+	g.Close()
+	return true
+}
+
+// Close closes every group of r, as Group.Close does, and so removes
+// them from r. r stays usable: groups can be created again afterwards.
+// Close always returns nil; it is an error so a Registry is an io.Closer.
+func (r *Registry) Close() error {
+	for _, g := range r.list() {
+		g.Close()
+	}
+	return nil
+}
+
+// remove removes g from r unless another group took its name.
+func (r *Registry) remove(g *Group) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.groups[g.name] == g {
+		delete(r.groups, g.name)
+	}
+}
+
+// list returns the groups of r.
+func (r *Registry) list() []*Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		list = append(list, g)
+	}
+	return list
+}
+
+// RegisterNewGroupHook registers fn to be called synchronously with every
+// new group of r before NewGroup returns it. It may be called more than
+// once.
+//
+// Deprecated: use Subscribe with EventGroupCreated. The hook is kept
+// for code that must configure a group before its first Get.
+func (r *Registry) RegisterNewGroupHook(fn func(*Group)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.newGroupHooks = append(r.newGroupHooks, fn)
+}
+
+// RegisterServeStart registers fn to be called once, when the first group
+// of r is created. It may be called more than once; hooks registered
+// after the first group never run.
+//
+// Deprecated: use Subscribe with EventGroupCreated.
+func (r *Registry) RegisterServeStart(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.serveStartHooks = append(r.serveStartHooks, fn)
+}
+
+func (r *Registry) callInitPeerServer() {
+	for _, fn := range r.serveStartHooks {
+		fn()
+	}
+}
+
+// RegisterPeerPicker registers the peer picker of the groups of r
+// created without one. It is called once, when the group serves its
+// first Get.
+func (r *Registry) RegisterPeerPicker(fn func() PeerPicker) {
+	r.RegisterPerGroupPeerPicker(func(_ string) PeerPicker { return fn() })
+}
+
+// RegisterPerGroupPeerPicker is like RegisterPeerPicker but lets each
+// group of r use a different PeerPicker.
+func (r *Registry) RegisterPerGroupPeerPicker(fn func(groupName string) PeerPicker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.portPicker != nil {
+		panic("RegisterPeerPicker called more than once")
+	}
+	r.portPicker = fn
+}
+
+func (r *Registry) getPeers(groupName string) PeerPicker {
+	r.mu.RLock()
+	fn := r.portPicker
+	r.mu.RUnlock()
+
+	if fn == nil {
+		return NoPeers{}
+	}
+	pk := fn(groupName)
+	if pk == nil {
+		pk = NoPeers{}
+	}
+	return pk
+}
+
+// MetricsHandler is like the package level MetricsHandler but reports
+// the groups of r.
+func (r *Registry) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		serveMetrics(w, r.list())
+	})
+}
+
+// reg returns the registry of g. Groups built without NewGroup
+// belong to the default registry.
+func (g *Group) reg() *Registry {
+	if g.registry == nil {
+		return defaultRegistry
+	}
+	return g.registry
+}
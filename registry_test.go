@@ -0,0 +1,80 @@
+package groupcache
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistriesAreIndependent(t *testing.T) {
+	t.Parallel()
+	a, b := newTestRegistry(t), newTestRegistry(t)
+	getter := func(v string) Getter {
+		return GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			return dest.SetString(v)
+		})
+	}
+	// 同名的 group 可以存在于不同的 registry
+	ga := a.NewGroup("tenant", 1<<20, getter("a"), NoPeers{})
+	gb := b.NewGroup("tenant", 1<<20, getter("b"), NoPeers{})
+	if a.GetGroup("tenant") != ga || b.GetGroup("tenant") != gb {
+		t.Fatal("registry returned another registry's group")
+	}
+	if GetGroup("tenant") != nil {
+		t.Error("group of a registry leaked into the default registry")
+	}
+
+	// 每个 registry 的 pool 只服务自己的 group
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: b}))
+	defer ts.Close()
+	peer := &httpGetter{baseURL: ts.URL + defaultBasePath}
+	ga.peers = keyPicker{peer: peer}
+	var s string
+	if err := ga.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "b" {
+		t.Errorf("Get through registry b's pool = %q; want %q", s, "b")
+	}
+
+	rec := httptest.NewRecorder()
+	b.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), `groupcache_server_requests_total{group="tenant"} 1`) {
+		t.Errorf("registry b metrics do not show its group:\n%s", body)
+	}
+}
+
+func TestRegistryPeerPicker(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	var created []string
+	r.RegisterNewGroupHook(func(g *Group) { created = append(created, g.name) })
+	peer := failingPeer{}
+	r.RegisterPerGroupPeerPicker(func(name string) PeerPicker {
+		return keyPicker{prefix: name, peer: peer}
+	})
+
+	g := r.NewGroup("g", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), nil)
+	var s string
+	if err := g.Get(context.TODO(), "g-key", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if n := g.Stats.PeerErrors.Get(); n != 1 {
+		t.Errorf("PeerErrors = %d; want 1 from the registry's picker", n)
+	}
+	if len(created) != 1 || created[0] != "g" {
+		t.Errorf("new group hooks saw %q; want [g]", created)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("second RegisterPeerPicker did not panic")
+		}
+	}()
+	r.RegisterPeerPicker(func() PeerPicker { return NoPeers{} })
+}
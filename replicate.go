@@ -0,0 +1,207 @@
+package groupcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HotPusher is optionally implemented by a ProtoGetter whose peer
+// accepts values pushed into its hotCache, needed by hot key replication.
+type HotPusher interface {
+	// PushHot stores the value of generation gen in the peer's hotCache
+	// until expire. A peer already past gen drops the push.
+	PushHot(ctx context.Context, group, key string, gen uint64, value []byte, expire time.Time) error
+}
+
+// ReplicationOptions configures owner-pushed hot key replication.
+//
+// When a key this process owns is requested by peers at least Threshold
+// times per second, its value is pushed into every peer's hotCache so
+// their next requests do not reach the owner. Pushed copies expire after
+// Expire; a key that is still hot is pushed again before that, so the
+// replication stops by itself once the spike passes.
+type ReplicationOptions struct {
+	// Threshold is the rate in requests per second, as measured by hot
+	// key detection, above which a key is replicated. Zero disables
+	// replication.
+	Threshold float64
+
+	// Expire is how long pushed copies live. If zero, it defaults to 10s.
+	Expire time.Duration
+
+	// MaxPushRate limits how many keys per second are pushed. If zero,
+	// it defaults to 10.
+	MaxPushRate float64
+}
+
+const (
+	defaultReplicaExpire  = 10 * time.Second
+	defaultMaxPushRate    = 10
+	replicationTimeout    = 5 * time.Second
+	maxReplicatedTracking = 1024
+)
+
+func (o *ReplicationOptions) withDefaults() ReplicationOptions {
+	opts := *o
+	if opts.Expire <= 0 {
+		opts.Expire = defaultReplicaExpire
+	}
+	if opts.MaxPushRate <= 0 {
+		opts.MaxPushRate = defaultMaxPushRate
+	}
+	return opts
+}
+
+// SetReplicationOptions enables hot key replication. It must be called
+// before the group serves its first Get.
+func (g *Group) SetReplicationOptions(o ReplicationOptions) {
+	g.replicas.opts = o.withDefaults()
+}
+
+// replicator decides when keys are pushed to peers.
+type replicator struct {
+	opts ReplicationOptions
+
+	mu     sync.Mutex
+	next   map[string]time.Time // 每个 key 下一次可以推送的时间
+	tokens float64
+	last   time.Time
+}
+
+// claim reports whether key may be pushed now, and if so records it.
+func (r *replicator) claim(key string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Before(r.next[key]) {
+		return false
+	}
+
+	// 令牌桶 容量是一秒的推送数
+	r.tokens += now.Sub(r.last).Seconds() * r.opts.MaxPushRate
+	if r.tokens > r.opts.MaxPushRate {
+		r.tokens = r.opts.MaxPushRate
+	}
+	r.last = now
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+
+	if r.next == nil {
+		r.next = make(map[string]time.Time)
+	}
+	if len(r.next) >= maxReplicatedTracking {
+		for k, t := range r.next {
+			if !now.Before(t) {
+				delete(r.next, k)
+			}
+		}
+	}
+	// 副本过期前一半的时间重新推送
+	r.next[key] = now.Add(r.opts.Expire / 2)
+	return true
+}
+
+// replicaRead records when the peer servers began reading a value that
+// maybeReplicate may push.
+type replicaRead struct {
+	gen uint64 // 读取前的代
+	seq uint64 // 读取前的 invalidations seq
+}
+
+// beginReplicaRead is called by the peer servers before reading a value
+// that may be pushed. done must be called after maybeReplicate.
+func (g *Group) beginReplicaRead() (r replicaRead, done func()) {
+	if g.replicas.opts.Threshold <= 0 {
+		return replicaRead{}, func() {}
+	}
+	r.seq = g.inval.begin()
+	r.gen = g.Generation()
+	return r, g.inval.end
+}
+
+// maybeReplicate is called by the peer servers after serving key to a
+// peer, alone or in a batch. It pushes the value, read since r and
+// possibly compressed, to every peer if the key is hot enough. Pushed
+// copies expire with the value, or after Expire if that comes first.
+//
+// A Set or Remove of key may reach a peer before the push does. If key
+// was invalidated here since r, the push is skipped, or, if it already
+// went out, followed by a Remove so no peer keeps the old value.
+func (g *Group) maybeReplicate(key string, r replicaRead, view ByteView) {
+	if g.replicas.opts.Threshold <= 0 {
+		return
+	}
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return
+	}
+	now := g.now()
+	if g.hot.qps(key, now) < g.replicas.opts.Threshold || !g.replicas.claim(key, now) {
+		return
+	}
+
+	// 副本不能比拥有者的值活得更久
+	expire := now.Add(g.replicas.opts.Expire)
+	if !view.e.IsZero() && view.e.Before(expire) {
+		if !view.e.After(now) {
+			return
+		}
+		expire = view.e
+	}
+	g.Stats.HotPushes.Add(1)
+	// 调用方的 begin 还没结束 这里再 begin 一次 保证推送期间的失效都被记下
+	g.inval.begin()
+	started := g.bg.start(func(ctx context.Context) {
+		defer g.inval.end()
+		ctx, cancel := context.WithTimeout(ctx, replicationTimeout)
+		defer cancel()
+
+		if g.inval.invalidated(key, r.seq) {
+			return
+		}
+		// 推送不带压缩格式 发送原值
+		view, err := g.decompress(view)
+		if err != nil {
+			return
+		}
+		value := view.bytes()
+		var wg sync.WaitGroup
+		for _, peer := range lister.GetAll() {
+			p, ok := peer.(HotPusher)
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := p.PushHot(ctx, g.name, key, r.gen, value, expire); err != nil {
+					g.Stats.HotPushErrs.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// 推送途中 key 被修改了 节点上可能留下旧值
+		if g.inval.invalidated(key, r.seq) {
+			g.removeFromPeers(ctx, key, nil)
+		}
+	})
+	if !started {
+		g.inval.end()
+	}
+}
+
+// setHotLocally is the peer side of PushHot.
+// 推送的副本只放进 hotCache 到期自动失效
+func (g *Group) setHotLocally(key string, gen uint64, value ByteView) {
+	g.observeGeneration(gen)
+	if gen < g.Generation() {
+		return
+	}
+	start := g.inval.begin()
+	defer g.inval.end()
+	g.populateSince(start, cacheKey{key: key, gen: gen}, value, &g.hotCache)
+}
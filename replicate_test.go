@@ -0,0 +1,279 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/gcache/groupcachetest"
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// pushRecorder is a peer that records the values pushed to it and the
+// keys removed from it. If block is set, PushHot signals started and
+// waits for block.
+type pushRecorder struct {
+	started, block chan struct{}
+
+	mu      sync.Mutex
+	pushed  map[string]time.Time
+	removed []string
+}
+
+func (r *pushRecorder) Get(context.Context, *pb.GetRequest, *pb.GetResponse) error {
+	return nil
+}
+
+func (r *pushRecorder) PushHot(_ context.Context, group, key string, gen uint64, value []byte, expire time.Time) error {
+	if r.block != nil {
+		r.started <- struct{}{}
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pushed == nil {
+		r.pushed = make(map[string]time.Time)
+	}
+	r.pushed[key] = expire
+	return nil
+}
+
+func (r *pushRecorder) Set(context.Context, string, string, []byte, time.Time) error {
+	return nil
+}
+
+func (r *pushRecorder) Remove(_ context.Context, group, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removed = append(r.removed, key)
+	return nil
+}
+
+// ownerOfAll owns every key and lists its peers.
+type ownerOfAll []ProtoGetter
+
+func (ownerOfAll) PickPeer(string) (ProtoGetter, bool) { return nil, false }
+func (p ownerOfAll) GetAll() []ProtoGetter             { return p }
+
+func TestReplicatorClaim(t *testing.T) {
+	r := replicator{opts: (&ReplicationOptions{Threshold: 1, Expire: 10 * time.Second, MaxPushRate: 2}).withDefaults()}
+	now := time.Now()
+
+	if !r.claim("a", now) {
+		t.Fatal("first push of a refused")
+	}
+	if r.claim("a", now.Add(time.Second)) {
+		t.Error("a pushed again long before its copies expire")
+	}
+	if !r.claim("b", now) {
+		t.Error("b refused with a token left")
+	}
+	if r.claim("c", now) {
+		t.Error("c pushed beyond MaxPushRate")
+	}
+	if !r.claim("c", now.Add(time.Second)) {
+		t.Error("c refused after the bucket refilled")
+	}
+	// 过期前一半的时间重新推送
+	if !r.claim("a", now.Add(5*time.Second)) {
+		t.Error("still hot a not pushed again")
+	}
+}
+
+func TestHotKeyReplication(t *testing.T) {
+	peer := &pushRecorder{}
+	g := newTestGroup("hot-key-replication", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), ownerOfAll{peer})
+	g.SetReplicationOptions(ReplicationOptions{Threshold: 1, Expire: time.Minute})
+	ctx := context.TODO()
+
+	for i := 0; i < 100; i++ {
+		var value []byte
+		for _, key := range []string{"hot", "cold" + string(rune('a'+i%26))} {
+			if err := g.Get(ctx, key, AllocatingByteSliceSink(&value)); err != nil {
+				t.Fatal(err)
+			}
+			g.maybeReplicate(key, replicaRead{}, ByteView{b: value})
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		peer.mu.Lock()
+		expire, ok := peer.pushed["hot"]
+		n := len(peer.pushed)
+		peer.mu.Unlock()
+		if ok {
+			if n != 1 {
+				t.Errorf("pushed %d keys; want only the hot one", n)
+			}
+			if d := time.Until(expire); d < 50*time.Second || d > time.Minute {
+				t.Errorf("pushed copy expires in %v; want about a minute", d)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hot key never pushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := g.Stats.HotPushes.Get(); n != 1 {
+		t.Errorf("HotPushes = %d; want 1", n)
+	}
+}
+
+func TestReplicaExpiresWithOwner(t *testing.T) {
+	t.Parallel()
+	clk := groupcachetest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	peer := &pushRecorder{}
+	g, err := newTestRegistry(t).NewGroupWithOptions("replica-expire", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), WithCacheBytes(1<<20), WithPeers(ownerOfAll{peer}), WithClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetRefreshOptions(RefreshOptions{TTL: 10 * time.Second})
+	g.SetReplicationOptions(ReplicationOptions{Threshold: 1, Expire: time.Minute})
+
+	// 经过批量请求的路径 热点 key 也会推送
+	for i := 0; i < 100; i++ {
+		if _, err := g.serveBatch(context.TODO(), []string{"hot"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owner, ok := g.lookupCache(g.cacheKey("hot"))
+	if !ok || owner.e.IsZero() {
+		t.Fatal("owner has no expiring entry for hot")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		peer.mu.Lock()
+		expire, ok := peer.pushed["hot"]
+		peer.mu.Unlock()
+		if ok {
+			if expire.After(owner.e) {
+				t.Errorf("replica expires at %v, after the owner's entry at %v", expire, owner.e)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hot key read in batches never pushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPushHotHTTP(t *testing.T) {
+	reg := newTestRegistry(t)
+	receiver := reg.NewGroup("push-hot-http", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("loaded")
+	}), NoPeers{})
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: reg}))
+	defer ts.Close()
+	peer := &httpGetter{baseURL: ts.URL + defaultBasePath}
+	testPushHot(t, peer, receiver)
+}
+
+func TestPushHotGRPC(t *testing.T) {
+	reg := newTestRegistry(t)
+	receiver := reg.NewGroup("push-hot-grpc", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("loaded")
+	}), NoPeers{})
+	lis := startBufconnServer(t, newGRPCPool("receiver", &GRPCPoolOptions{Registry: reg}))
+	pool := newGRPCPool("self", &GRPCPoolOptions{DialOptions: bufconnDialOptions(lis)})
+	defer pool.Close()
+	pool.Set("passthrough:///receiver")
+	testPushHot(t, pool.GetAll()[0].(HotPusher), receiver)
+}
+
+func testPushHot(t *testing.T, peer HotPusher, receiver *Group) {
+	t.Helper()
+	expire := time.Now().Add(time.Hour)
+	if err := peer.PushHot(context.TODO(), receiver.Name(), "k", receiver.Generation(), []byte("pushed"), expire); err != nil {
+		t.Fatal(err)
+	}
+	v, ok := receiver.hotCache.get(receiver.cacheKey("k"))
+	if !ok || v.String() != "pushed" {
+		t.Fatalf("receiver hotCache = %q, %v; want %q", v.String(), ok, "pushed")
+	}
+	if !v.Expire().Equal(expire) {
+		t.Errorf("pushed copy expires at %v; want %v", v.Expire(), expire)
+	}
+	if _, ok := receiver.mainCache.get(receiver.cacheKey("k")); ok {
+		t.Error("pushed value went into mainCache")
+	}
+
+	// 推送者还在旧的代 推送被丢弃
+	old := receiver.Generation()
+	receiver.observeGeneration(old + 1)
+	if err := peer.PushHot(context.TODO(), receiver.Name(), "old", old, []byte("pushed"), expire); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := receiver.hotCache.get(cacheKey{key: "old", gen: old}); ok {
+		t.Error("push of an older generation stored")
+	}
+
+	// 推送者的代更新 接收方跟上
+	if err := peer.PushHot(context.TODO(), receiver.Name(), "new", old+2, []byte("pushed"), expire); err != nil {
+		t.Fatal(err)
+	}
+	if gen := receiver.Generation(); gen != old+2 {
+		t.Errorf("receiver generation = %d; want %d", gen, old+2)
+	}
+	if _, ok := receiver.hotCache.get(receiver.cacheKey("new")); !ok {
+		t.Error("push of a newer generation not stored")
+	}
+}
+
+func TestHotPushAfterInvalidation(t *testing.T) {
+	peer := &pushRecorder{}
+	g := newTestGroup("hot-push-after-invalidation", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), ownerOfAll{peer})
+	g.SetReplicationOptions(ReplicationOptions{Threshold: 1e-9, Expire: time.Minute})
+	g.hot.hit("k", g.now())
+
+	// Remove 在读取之后 推送之前到达
+	read, done := g.beginReplicaRead()
+	g.removeLocally("k")
+	g.maybeReplicate("k", read, ByteView{s: "old"})
+	done()
+	g.Close()
+
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	if _, ok := peer.pushed["k"]; ok {
+		t.Error("value read before a Remove was pushed")
+	}
+}
+
+func TestHotPushRacingInvalidation(t *testing.T) {
+	peer := &pushRecorder{started: make(chan struct{}, 1), block: make(chan struct{})}
+	g := newTestGroup("hot-push-racing-invalidation", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("v")
+	}), ownerOfAll{peer})
+	g.SetReplicationOptions(ReplicationOptions{Threshold: 1e-9, Expire: time.Minute})
+	g.hot.hit("k", g.now())
+
+	read, done := g.beginReplicaRead()
+	g.maybeReplicate("k", read, ByteView{s: "old"})
+	done()
+	// 推送已经发出 Remove 可能先到节点
+	<-peer.started
+	g.removeLocally("k")
+	close(peer.block)
+	g.Close()
+
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	if _, ok := peer.pushed["k"]; !ok {
+		t.Fatal("hot key never pushed")
+	}
+	if len(peer.removed) != 1 || peer.removed[0] != "k" {
+		t.Errorf("removed %q after the push; want [k]", peer.removed)
+	}
+}
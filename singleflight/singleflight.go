@@ -38,8 +38,19 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	c.wg.Done()
 
 	g.mu.Lock()
-	delete(g.m, key)
+	// Forget 之后同一个 key 可能已经有了新的调用
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
 	g.mu.Unlock()
 
 	return c.val, c.err
+}
+
+// Forget tells the Group to stop tracking a key. Later calls to Do for
+// it start a new call instead of waiting for the one in flight.
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
 }
\ No newline at end of file
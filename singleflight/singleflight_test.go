@@ -73,3 +73,26 @@ func TestDoDupSuppress(t *testing.T) {
 		t.Errorf("number of calls = %d; want 1", got)
 	}
 }
+
+func TestForget(t *testing.T) {
+	var g Group
+	first := make(chan string)
+	started := make(chan bool)
+
+	go g.Do("key", func() (interface{}, error) {
+		started <- true
+		return <-first, nil
+	})
+	<-started
+
+	g.Forget("key")
+
+	// 新的调用不会等待被 Forget 的调用
+	v, _ := g.Do("key", func() (interface{}, error) {
+		return "second", nil
+	})
+	if v != "second" {
+		t.Errorf("Do after Forget = %v; want %q", v, "second")
+	}
+	first <- "first"
+}
@@ -0,0 +1,290 @@
+package groupcache
+
+import (
+	"hash/maphash"
+	"time"
+
+	cachepolicy "example.com/gcache/cache_policy"
+)
+
+// viewPolicy is implemented by policies made for the caches of a group.
+// The cache calls these methods instead of the cachepolicy.Policy ones,
+// so keys and values are never boxed into interfaces.
+type viewPolicy interface {
+	cachepolicy.Policy
+	addView(key cacheKey, value ByteView)
+	getView(key cacheKey) (value ByteView, ok bool)
+	removeView(key cacheKey)
+	// setViewEvicted replaces the onEvicted callback of the policy. fn
+	// gets the key's bytes, which it must not keep.
+	setViewEvicted(fn func(key []byte, gen uint64, value ByteView))
+}
+
+const (
+	// slabBits sets the entries per slab to 1<<slabBits.
+	slabBits = 12
+	// arenaChunk is the size of the chunks keys and values are copied
+	// into. Larger values get a chunk of their own.
+	arenaChunk = 64 << 10
+)
+
+// slabLRU is the policy of SlabLRU. It holds nothing the GC has to scan
+// per entry:
+//
+//   - entries live in slabs and are linked by index,
+//   - keys and values are copied into large byte chunks,
+//   - the index maps a hash of the key to the first entry of a chain.
+//
+// Removed bytes are not reused in place, so views returned by getView
+// stay valid; once more than half the chunk bytes are garbage the live
+// entries are copied into new chunks. A view keeps the chunk it points
+// into alive.
+type slabLRU struct {
+	onEvicted func(key []byte, gen uint64, value ByteView)
+
+	// 下标 0 是链表的哨兵 next 是最新的 prev 是最旧的
+	slabs [][]slabEntry
+	used  int32 // 用过的下标数 包括哨兵
+	free  int32 // 空闲链表 通过 next 串起来 0 表示没有
+	len   int
+
+	seed  maphash.Seed
+	index map[uint64]int32 // hash 到链表头 同一个 hash 的条目通过 hnext 串起来
+
+	chunks [][]byte
+	pos    int   // 最后一个共享 chunk 里已经用掉的字节
+	cur    int32 // 最后一个共享 chunk 的下标 -1 表示没有
+	live   int   // 存活条目的 key 和 value 的字节数
+	total  int   // 所有 chunk 的字节数
+}
+
+type slabEntry struct {
+	prev, next int32
+	hnext      int32
+	chunk, off int32 // key 之后紧跟着 value
+	klen, vlen int32
+	flags      uint8
+	gen        uint64
+	hash       uint64
+	expire     int64 // UnixNano 只在 flagExpire 时有效
+}
+
+const (
+	flagExpire uint8 = 1 << iota
+	flagCompressed
+)
+
+func newSlabLRU() *slabLRU {
+	return &slabLRU{
+		slabs: [][]slabEntry{make([]slabEntry, 1<<slabBits)},
+		used:  1,
+		seed:  maphash.MakeSeed(),
+		index: make(map[uint64]int32),
+		cur:   -1,
+	}
+}
+
+func (c *slabLRU) at(i int32) *slabEntry {
+	return &c.slabs[i>>slabBits][i&(1<<slabBits-1)]
+}
+
+func (c *slabLRU) hash(key cacheKey) uint64 {
+	return maphash.String(c.seed, key.key) ^ key.gen*0x9e3779b97f4a7c15
+}
+
+// find returns the entry of key, or 0.
+func (c *slabLRU) find(key cacheKey, h uint64) int32 {
+	for i := c.index[h]; i != 0; {
+		e := c.at(i)
+		if e.hash == h && e.gen == key.gen && int(e.klen) == len(key.key) &&
+			string(c.keyBytes(e)) == key.key {
+			return i
+		}
+		i = e.hnext
+	}
+	return 0
+}
+
+func (c *slabLRU) keyBytes(e *slabEntry) []byte {
+	return c.chunks[e.chunk][e.off : e.off+e.klen]
+}
+
+func (c *slabLRU) view(e *slabEntry) ByteView {
+	end := e.off + e.klen + e.vlen
+	v := ByteView{b: c.chunks[e.chunk][e.off+e.klen : end : end], z: e.flags&flagCompressed != 0}
+	if e.flags&flagExpire != 0 {
+		v.e = time.Unix(0, e.expire)
+	}
+	return v
+}
+
+func (c *slabLRU) addView(key cacheKey, value ByteView) {
+	h := c.hash(key)
+	if i := c.find(key, h); i != 0 {
+		c.removeEntry(i, false)
+	}
+
+	i := c.alloc()
+	e := c.at(i)
+	e.chunk, e.off = c.store(len(key.key) + value.Len())
+	buf := c.chunks[e.chunk][e.off:]
+	copy(buf, key.key)
+	value.Copy(buf[len(key.key):])
+	e.klen, e.vlen = int32(len(key.key)), int32(value.Len())
+	e.gen, e.hash = key.gen, h
+	if !value.e.IsZero() {
+		e.flags |= flagExpire
+		e.expire = value.e.UnixNano()
+	}
+	if value.z {
+		e.flags |= flagCompressed
+	}
+	c.live += len(key.key) + value.Len()
+
+	e.hnext = c.index[h]
+	c.index[h] = i
+	c.pushFront(i)
+}
+
+func (c *slabLRU) getView(key cacheKey) (value ByteView, ok bool) {
+	i := c.find(key, c.hash(key))
+	if i == 0 {
+		return
+	}
+	c.moveToFront(i)
+	return c.view(c.at(i)), true
+}
+
+func (c *slabLRU) removeView(key cacheKey) {
+	if i := c.find(key, c.hash(key)); i != 0 {
+		c.removeEntry(i, true)
+	}
+}
+
+func (c *slabLRU) setViewEvicted(fn func(key []byte, gen uint64, value ByteView)) {
+	c.onEvicted = fn
+}
+
+// Add, Get and Remove make slabLRU a cachepolicy.Policy.
+func (c *slabLRU) Add(key cachepolicy.Key, value interface{}) {
+	c.addView(key.(cacheKey), value.(ByteView))
+}
+
+func (c *slabLRU) Get(key cachepolicy.Key) (value interface{}, ok bool) {
+	return c.getView(key.(cacheKey))
+}
+
+func (c *slabLRU) Remove(key cachepolicy.Key) {
+	c.removeView(key.(cacheKey))
+}
+
+func (c *slabLRU) RemoveOldest() {
+	if i := c.at(0).prev; i != 0 {
+		c.removeEntry(i, true)
+	}
+}
+
+func (c *slabLRU) Len() int {
+	return c.len
+}
+
+// removeEntry removes entry i, calling onEvicted if notify is set.
+func (c *slabLRU) removeEntry(i int32, notify bool) {
+	c.unlink(i)
+	e := c.at(i)
+	// 从 hash 链表中摘掉
+	if head := c.index[e.hash]; head == i {
+		if e.hnext == 0 {
+			delete(c.index, e.hash)
+		} else {
+			c.index[e.hash] = e.hnext
+		}
+	} else {
+		p := c.at(head)
+		for p.hnext != i {
+			p = c.at(p.hnext)
+		}
+		p.hnext = e.hnext
+	}
+	if notify && c.onEvicted != nil {
+		c.onEvicted(c.keyBytes(e), e.gen, c.view(e))
+	}
+	c.live -= int(e.klen + e.vlen)
+	*e = slabEntry{next: c.free}
+	c.free = i
+	if c.total > 2*c.live+4*arenaChunk {
+		c.compact()
+	}
+}
+
+// store reserves n bytes and returns where they are.
+func (c *slabLRU) store(n int) (chunk, off int32) {
+	if n > arenaChunk/4 {
+		// 大的值单独一个 chunk
+		c.chunks = append(c.chunks, make([]byte, n))
+		c.total += n
+		return int32(len(c.chunks) - 1), 0
+	}
+	if c.cur < 0 || c.pos+n > arenaChunk {
+		c.chunks = append(c.chunks, make([]byte, arenaChunk))
+		c.total += arenaChunk
+		c.cur, c.pos = int32(len(c.chunks)-1), 0
+	}
+	off = int32(c.pos)
+	c.pos += n
+	return c.cur, off
+}
+
+// compact copies the live keys and values into new chunks, dropping the
+// garbage of removed entries.
+func (c *slabLRU) compact() {
+	old := c.chunks
+	c.chunks, c.cur, c.pos, c.total = nil, -1, 0, 0
+	for i := c.at(0).next; i != 0; {
+		e := c.at(i)
+		n := e.klen + e.vlen
+		src := old[e.chunk][e.off : e.off+n]
+		e.chunk, e.off = c.store(int(n))
+		copy(c.chunks[e.chunk][e.off:], src)
+		i = e.next
+	}
+}
+
+// alloc returns the index of an unused entry.
+func (c *slabLRU) alloc() int32 {
+	if i := c.free; i != 0 {
+		c.free = c.at(i).next
+		return i
+	}
+	if int(c.used) == len(c.slabs)<<slabBits {
+		c.slabs = append(c.slabs, make([]slabEntry, 1<<slabBits))
+	}
+	i := c.used
+	c.used++
+	return i
+}
+
+func (c *slabLRU) pushFront(i int32) {
+	root := c.at(0)
+	e := c.at(i)
+	e.prev, e.next = 0, root.next
+	c.at(root.next).prev = i
+	root.next = i
+	c.len++
+}
+
+func (c *slabLRU) unlink(i int32) {
+	e := c.at(i)
+	c.at(e.prev).next = e.next
+	c.at(e.next).prev = e.prev
+	e.prev, e.next = 0, 0
+	c.len--
+}
+
+func (c *slabLRU) moveToFront(i int32) {
+	if c.at(0).next == i {
+		return
+	}
+	c.unlink(i)
+	c.pushFront(i)
+}
@@ -0,0 +1,162 @@
+package groupcache
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cachepolicy "example.com/gcache/cache_policy"
+)
+
+// 和 LRU 做同样的操作 结果必须一致
+func TestSlabLRUMatchesLRU(t *testing.T) {
+	var slabEvicted, lruEvicted []string
+	slab := SlabLRU(func(key cachepolicy.Key, value interface{}) {
+		slabEvicted = append(slabEvicted, fmt.Sprint(key, value.(ByteView).String()))
+	})
+	lru := LRU(func(key cachepolicy.Key, value interface{}) {
+		lruEvicted = append(lruEvicted, fmt.Sprint(key, value.(ByteView).String()))
+	})
+	expire := time.Unix(1e9, 0)
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 50000; i++ {
+		key := cacheKey{key: "k" + strconv.Itoa(rnd.Intn(3000)), gen: uint64(rnd.Intn(2))}
+		switch n := rnd.Intn(10); {
+		case n < 2:
+			slab.Remove(key)
+			lru.Remove(key)
+		case n < 5:
+			v1, ok1 := slab.Get(key)
+			v2, ok2 := lru.Get(key)
+			if ok1 != ok2 || ok1 && !viewsEqual(v1.(ByteView), v2.(ByteView)) {
+				t.Fatalf("step %d: Get(%v) = %v, %v; LRU has %v, %v", i, key, v1, ok1, v2, ok2)
+			}
+		case n < 6:
+			slab.RemoveOldest()
+			lru.RemoveOldest()
+		default:
+			// 偶尔放一个单独占一个 chunk 的大值
+			size := rnd.Intn(200)
+			if rnd.Intn(100) == 0 {
+				size = arenaChunk
+			}
+			v := ByteView{s: strings.Repeat(strconv.Itoa(i%10), size), z: i%3 == 0}
+			if i%2 == 0 {
+				v.e = expire.Add(time.Duration(i))
+			}
+			slab.Add(key, v)
+			lru.Add(key, v)
+		}
+	}
+	if slab.Len() != lru.Len() {
+		t.Errorf("Len = %d; LRU has %d", slab.Len(), lru.Len())
+	}
+	for slab.Len() > 0 {
+		slab.RemoveOldest()
+		lru.RemoveOldest()
+	}
+	if fmt.Sprint(slabEvicted) != fmt.Sprint(lruEvicted) {
+		t.Error("evictions differ from LRU")
+	}
+	if c := slab.(*slabLRU); c.live != 0 || len(c.index) != 0 {
+		t.Errorf("empty slab holds %d live bytes, %d index entries", c.live, len(c.index))
+	}
+}
+
+func viewsEqual(a, b ByteView) bool {
+	return a.String() == b.String() && a.e.Equal(b.e) && a.z == b.z
+}
+
+// 压缩之后 之前读出的值不受影响
+func TestSlabLRUViewsSurviveCompaction(t *testing.T) {
+	c := newSlabLRU()
+	c.addView(cacheKey{key: "keep"}, ByteView{s: "kept"})
+	v, _ := c.getView(cacheKey{key: "keep"})
+
+	compacted := false
+	for i := 0; !compacted; i++ {
+		before := len(c.chunks)
+		key := cacheKey{key: strconv.Itoa(i % 10)}
+		c.addView(key, ByteView{s: strings.Repeat("x", 1000)})
+		compacted = len(c.chunks) < before
+		if i > 1e5 {
+			t.Fatal("chunks never compacted")
+		}
+	}
+	if v.String() != "kept" {
+		t.Errorf("view read before compaction = %q; want kept", v.String())
+	}
+	if v, ok := c.getView(cacheKey{key: "keep"}); !ok || v.String() != "kept" {
+		t.Errorf("after compaction Get = %q, %v; want kept", v.String(), ok)
+	}
+	if c.total > 2*c.live+4*arenaChunk {
+		t.Errorf("chunks hold %d bytes for %d live", c.total, c.live)
+	}
+}
+
+func BenchmarkSlabLRUPolicyAdd(b *testing.B) {
+	benchmarkPolicyAdd(b, SlabLRU)
+}
+
+func BenchmarkLRUPolicyAdd(b *testing.B) {
+	benchmarkPolicyAdd(b, LRU)
+}
+
+func benchmarkPolicyAdd(b *testing.B, policy EvictionPolicy) {
+	c := &cache{policy: policy}
+	keys := make([]cacheKey, 1000)
+	for i := range keys {
+		keys[i] = cacheKey{key: "key" + strconv.Itoa(i)}
+	}
+	value := ByteView{b: make([]byte, 32)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.add(keys[i%len(keys)], value)
+		c.get(keys[(i+500)%len(keys)])
+	}
+}
+
+const gcBenchEntries = 1 << 20
+
+// The GC benchmarks fill a group's cache, the way the group does, with
+// small values and then time full GCs while it is alive. They report
+// the allocations made per entry while filling, and the GC pauses per
+// collection.
+func BenchmarkGCSlabLRUPolicy(b *testing.B) {
+	benchmarkPolicyGC(b, SlabLRU)
+}
+
+func BenchmarkGCLRUPolicy(b *testing.B) {
+	benchmarkPolicyGC(b, LRU)
+}
+
+func benchmarkPolicyGC(b *testing.B, policy EvictionPolicy) {
+	c := &cache{policy: policy}
+	value := make([]byte, 32)
+	var start, filled, end runtime.MemStats
+	runtime.ReadMemStats(&start)
+	for i := 0; i < gcBenchEntries; i++ {
+		// 和 group 一样 每个值是加载时新分配的
+		c.add(cacheKey{key: "key" + strconv.Itoa(i)}, ByteView{b: cloneBytes(value)})
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&filled)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&end)
+	runtime.KeepAlive(c)
+
+	b.ReportMetric(float64(filled.Mallocs-start.Mallocs)/gcBenchEntries, "allocs/entry")
+	b.ReportMetric(float64(end.HeapAlloc)/gcBenchEntries, "heap-B/entry")
+	b.ReportMetric(float64(end.PauseTotalNs-filled.PauseTotalNs)/float64(b.N), "pause-ns/gc")
+}
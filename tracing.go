@@ -0,0 +1,140 @@
+package groupcache
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Tracer starts spans around the steps of a Get. It is shaped after
+// OpenTelemetry so an adapter is a few lines; the package itself does not
+// depend on any tracing library.
+type Tracer interface {
+	// Start starts a span named name as a child of the span in ctx, if
+	// any, and returns a context holding the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is one traced operation.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// End finishes the span. err is the operation's error, or nil.
+	End(err error)
+}
+
+// TracePropagator is optionally implemented by a Tracer that can carry
+// trace context to peers. Its fields travel as HTTP headers or gRPC
+// metadata with every peer Get.
+type TracePropagator interface {
+	// Inject writes the trace context of ctx into carrier.
+	Inject(ctx context.Context, carrier map[string]string)
+	// Extract returns ctx with the trace context read from carrier.
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+	// Fields lists the carrier keys Inject may set.
+	Fields() []string
+}
+
+// Span names used by Group.
+const (
+	SpanGet          = "groupcache.Get"
+	SpanLookupCache  = "groupcache.lookupCache"
+	SpanSingleflight = "groupcache.singleflight"
+	SpanPickPeer     = "groupcache.PickPeer"
+	SpanPeerGet      = "groupcache.peerGet"
+	SpanGetLocally   = "groupcache.getLocally"
+	SpanGetMulti     = "groupcache.GetMulti"
+	SpanPeerGetBatch = "groupcache.peerGetBatch" // one batched request to a peer
+	SpanGetBatch     = "groupcache.getBatchLocally"
+)
+
+// Span attribute keys used by Group.
+const (
+	AttrGroup   = "groupcache.group"
+	AttrHit     = "groupcache.hit"     // main, hot, stale, not_found or miss
+	AttrDeduped = "groupcache.deduped" // the load was shared with another Get
+	AttrPeer    = "groupcache.peer"
+	AttrBytes   = "groupcache.bytes"
+	AttrKeys    = "groupcache.keys" // number of keys of a batch
+)
+
+// SetTracer makes the group trace its Gets with t. It must be called
+// before the group serves its first Get.
+func (g *Group) SetTracer(t Tracer) {
+	g.tracer = t
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
+
+func (g *Group) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if g.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	ctx, span := g.tracer.Start(ctx, name)
+	span.SetAttribute(AttrGroup, g.name)
+	return ctx, span
+}
+
+// traceHeadersKey is the context key of the trace fields a peer
+// transport sends with its request.
+type traceHeadersKey struct{}
+
+// injectTrace stores the trace context of ctx for the peer transport.
+func (g *Group) injectTrace(ctx context.Context) context.Context {
+	p, ok := g.tracer.(TracePropagator)
+	if !ok {
+		return ctx
+	}
+	carrier := make(map[string]string)
+	p.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, traceHeadersKey{}, carrier)
+}
+
+func traceHeaders(ctx context.Context) map[string]string {
+	carrier, _ := ctx.Value(traceHeadersKey{}).(map[string]string)
+	return carrier
+}
+
+// extractTrace returns ctx with the trace context a peer sent, read
+// with get.
+func (g *Group) extractTrace(ctx context.Context, get func(key string) string) context.Context {
+	p, ok := g.tracer.(TracePropagator)
+	if !ok {
+		return ctx
+	}
+	carrier := make(map[string]string)
+	for _, key := range p.Fields() {
+		if v := get(key); v != "" {
+			carrier[key] = v
+		}
+	}
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return p.Extract(ctx, carrier)
+}
+
+// extractHTTPTrace reads trace context from request headers.
+func (g *Group) extractHTTPTrace(ctx context.Context, h http.Header) context.Context {
+	return g.extractTrace(ctx, h.Get)
+}
+
+// extractGRPCTrace reads trace context from incoming gRPC metadata.
+func (g *Group) extractGRPCTrace(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return g.extractTrace(ctx, func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	})
+}
@@ -0,0 +1,228 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type recordedSpan struct {
+	name   string
+	trace  string
+	parent string
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+
+	rec *spanRecorder
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.attrs[key] = value
+}
+
+func (s *recordedSpan) End(err error) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.err = err
+	s.ended = true
+}
+
+type traceKey struct{}
+type spanKey struct{}
+
+// spanRecorder is an in-memory Tracer and TracePropagator.
+type spanRecorder struct {
+	mu     sync.Mutex
+	spans  []*recordedSpan
+	traces int
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	trace, _ := ctx.Value(traceKey{}).(string)
+	if trace == "" {
+		r.traces++
+		trace = "trace-" + strconv.Itoa(r.traces)
+		ctx = context.WithValue(ctx, traceKey{}, trace)
+	}
+	parent, _ := ctx.Value(spanKey{}).(string)
+	s := &recordedSpan{name: name, trace: trace, parent: parent, attrs: make(map[string]interface{}), rec: r}
+	r.spans = append(r.spans, s)
+	return context.WithValue(ctx, spanKey{}, name), s
+}
+
+func (r *spanRecorder) Inject(ctx context.Context, carrier map[string]string) {
+	if trace, ok := ctx.Value(traceKey{}).(string); ok {
+		carrier["X-Trace-Id"] = trace
+	}
+}
+
+func (r *spanRecorder) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return context.WithValue(ctx, traceKey{}, carrier["X-Trace-Id"])
+}
+
+func (r *spanRecorder) Fields() []string { return []string{"X-Trace-Id"} }
+
+// take returns and forgets the recorded spans.
+func (r *spanRecorder) take() []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := r.spans
+	r.spans = nil
+	return spans
+}
+
+func findSpan(spans []*recordedSpan, name, group string) *recordedSpan {
+	for _, s := range spans {
+		if s.name == name && s.attrs[AttrGroup] == group {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestTracingLocal(t *testing.T) {
+	const name = "tracing-local"
+	rec := &spanRecorder{}
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{})
+	g.SetTracer(rec)
+
+	var s string
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	spans := rec.take()
+	want := []struct {
+		name, parent string
+		attr         string
+		value        interface{}
+	}{
+		{SpanGet, "", AttrHit, hitMiss},
+		{SpanLookupCache, SpanGet, AttrHit, hitMiss},
+		{SpanSingleflight, SpanGet, AttrDeduped, false},
+		{SpanPickPeer, SpanSingleflight, "", nil},
+		{SpanGetLocally, SpanSingleflight, AttrBytes, 5},
+	}
+	for _, w := range want {
+		sp := findSpan(spans, w.name, name)
+		if sp == nil {
+			t.Errorf("no %s span", w.name)
+			continue
+		}
+		if !sp.ended || sp.parent != w.parent || sp.trace != "trace-1" {
+			t.Errorf("%s: ended %v, parent %q, trace %q; want parent %q in trace-1", w.name, sp.ended, sp.parent, sp.trace, w.parent)
+		}
+		if w.attr != "" && sp.attrs[w.attr] != w.value {
+			t.Errorf("%s: %s = %v; want %v", w.name, w.attr, sp.attrs[w.attr], w.value)
+		}
+	}
+	if get := findSpan(spans, SpanGet, name); get != nil && get.attrs[AttrBytes] != 5 {
+		t.Errorf("Get bytes = %v; want 5", get.attrs[AttrBytes])
+	}
+
+	g.Get(context.TODO(), "k", StringSink(&s))
+	spans = rec.take()
+	if len(spans) != 2 {
+		t.Errorf("cache hit recorded %d spans; want Get and lookupCache", len(spans))
+	}
+	if sp := findSpan(spans, SpanLookupCache, name); sp == nil || sp.attrs[AttrHit] != hitMain {
+		t.Errorf("lookupCache span of a hit = %+v", sp)
+	}
+}
+
+func TestTracingHTTPPeer(t *testing.T) {
+	const name = "tracing-http"
+	reg := newTestRegistry(t)
+	rec := &spanRecorder{}
+	owner := reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner")
+	}), NoPeers{})
+	owner.SetTracer(rec)
+
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: reg}))
+	defer ts.Close()
+	peer := &httpGetter{baseURL: ts.URL + defaultBasePath}
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), keyPicker{peer: peer})
+	g.SetTracer(rec)
+	testTracingPeer(t, rec, g, peer.peerName())
+}
+
+func TestTracingGRPCPeer(t *testing.T) {
+	const name = "tracing-grpc"
+	reg := newTestRegistry(t)
+	rec := &spanRecorder{}
+	owner := reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner")
+	}), NoPeers{})
+	owner.SetTracer(rec)
+
+	lis := startBufconnServer(t, newGRPCPool("owner", &GRPCPoolOptions{Registry: reg}))
+	pool := newGRPCPool("self", &GRPCPoolOptions{DialOptions: bufconnDialOptions(lis)})
+	defer pool.Close()
+	pool.Set("passthrough:///owner")
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), pool)
+	g.SetTracer(rec)
+	testTracingPeer(t, rec, g, "passthrough:///owner")
+}
+
+// testTracingPeer checks that a Get of g, whose keys are all owned by a
+// peer in this process, is traced on both sides in one trace.
+func testTracingPeer(t *testing.T, rec *spanRecorder, g *Group, peer string) {
+	t.Helper()
+	var s string
+	if err := g.Get(context.TODO(), "k", StringSink(&s)); err != nil || s != "owner" {
+		t.Fatalf("Get = %q, %v", s, err)
+	}
+
+	var gets []*recordedSpan
+	var peerGet *recordedSpan
+	for _, sp := range rec.take() {
+		switch sp.name {
+		case SpanGet:
+			gets = append(gets, sp)
+		case SpanPeerGet:
+			peerGet = sp
+		}
+	}
+	if peerGet == nil || peerGet.attrs[AttrPeer] != peer || peerGet.attrs[AttrBytes] != 5 {
+		t.Fatalf("peerGet span = %+v; want peer %q and 5 bytes", peerGet, peer)
+	}
+	// 本地和拥有者的 Get 在同一个 trace 里
+	if len(gets) != 2 || gets[0].trace != gets[1].trace {
+		t.Errorf("Get spans not in one trace: %+v", gets)
+	}
+
+	// 批量读取也一样
+	if values, err := getMultiStrings(g, []string{"a", "b"}); err != nil || values[0] != "owner" {
+		t.Fatalf("GetMulti = %q, %v", values, err)
+	}
+	var multis []*recordedSpan
+	var batch *recordedSpan
+	for _, sp := range rec.take() {
+		switch sp.name {
+		case SpanGetMulti:
+			multis = append(multis, sp)
+		case SpanPeerGetBatch:
+			batch = sp
+		}
+	}
+	if batch == nil || batch.attrs[AttrPeer] != peer || batch.attrs[AttrKeys] != 2 || batch.parent != SpanGetMulti || !batch.ended {
+		t.Fatalf("peerGetBatch span = %+v; want peer %q, 2 keys, under GetMulti", batch, peer)
+	}
+	if len(multis) != 2 || multis[0].trace != multis[1].trace || multis[0].trace != batch.trace {
+		t.Errorf("GetMulti spans not in one trace: %+v", multis)
+	}
+}
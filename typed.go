@@ -0,0 +1,169 @@
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec converts the values of a TypedGroup to and from the bytes a
+// Group caches.
+type Codec[V any] interface {
+	Marshal(v V) ([]byte, error)
+	// Unmarshal decodes data into v. data may be the cached bytes
+	// themselves, so Unmarshal must neither modify nor keep it.
+	Unmarshal(data []byte, v *V) error
+}
+
+// sinkCodec is implemented by codecs that write to and read from a Sink
+// directly, instead of going through bytes.
+type sinkCodec[V any] interface {
+	set(dest Sink, v V) error
+	sink(v *V) Sink
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Marshal(v V) ([]byte, error)       { return json.Marshal(v) }
+func (JSONCodec[V]) Unmarshal(data []byte, v *V) error { return json.Unmarshal(data, v) }
+
+// GobCodec encodes values with encoding/gob. Every value carries its
+// type description, so it suits a few large values better than many
+// small ones.
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) Marshal(v V) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[V]) Unmarshal(data []byte, v *V) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// protoCodec encodes proto messages of type M, a pointer to T.
+type protoCodec[T any, M interface {
+	*T
+	proto.Message
+}] struct{}
+
+// NewProtoCodec returns a codec for the proto message *T. Values are
+// read and written through ProtoSink and Sink.SetProto:
+//
+//	users := groupcache.NewProtoCodec[pb.User]()
+func NewProtoCodec[T any, M interface {
+	*T
+	proto.Message
+}]() Codec[M] {
+	return protoCodec[T, M]{}
+}
+
+func (protoCodec[T, M]) Marshal(m M) ([]byte, error) { return proto.Marshal(m) }
+
+func (protoCodec[T, M]) Unmarshal(data []byte, v *M) error {
+	m := M(new(T))
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	*v = m
+	return nil
+}
+
+func (protoCodec[T, M]) set(dest Sink, m M) error { return dest.SetProto(m) }
+
+func (protoCodec[T, M]) sink(v *M) Sink {
+	*v = M(new(T))
+	return ProtoSink(*v)
+}
+
+// TypedGetter returns a Getter that loads values with fn and stores them
+// encoded by codec.
+func TypedGetter[V any](codec Codec[V], fn func(ctx context.Context, key string) (V, error)) Getter {
+	return GetterFunc(func(ctx context.Context, key string, dest Sink) error {
+		v, err := fn(ctx, key)
+		if err != nil {
+			return err
+		}
+		if c, ok := codec.(sinkCodec[V]); ok {
+			return c.set(dest, v)
+		}
+		b, err := codec.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return dest.SetBytes(b)
+	})
+}
+
+// TypedGroup is a Group whose values are of type V.
+type TypedGroup[V any] struct {
+	g     *Group
+	codec Codec[V]
+}
+
+// Typed returns a typed view of g. g's Getter must store values encoded
+// by codec, as the Getters made by TypedGetter do.
+func Typed[V any](g *Group, codec Codec[V]) *TypedGroup[V] {
+	return &TypedGroup[V]{g: g, codec: codec}
+}
+
+// NewTypedGroup creates a group in the default registry that loads values
+// with fn and caches them encoded by codec.
+func NewTypedGroup[V any](name string, codec Codec[V], fn func(ctx context.Context, key string) (V, error), opts ...GroupOption) (*TypedGroup[V], error) {
+	g, err := NewGroupWithOptions(name, TypedGetter(codec, fn), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return Typed(g, codec), nil
+}
+
+// Group returns the underlying group.
+func (t *TypedGroup[V]) Group() *Group {
+	return t.g
+}
+
+// Get returns the value of key.
+func (t *TypedGroup[V]) Get(ctx context.Context, key string) (V, error) {
+	var v V
+	if c, ok := t.codec.(sinkCodec[V]); ok {
+		if err := t.g.Get(ctx, key, c.sink(&v)); err != nil {
+			var zero V
+			return zero, err
+		}
+		return v, nil
+	}
+
+	var view ByteView
+	if err := t.g.Get(ctx, key, ByteViewSink(&view)); err != nil {
+		return v, err
+	}
+	// 缓存中的字节直接交给解码 不复制
+	if err := t.codec.Unmarshal(view.bytes(), &v); err != nil {
+		// 解码失败时 v 可能只解了一半
+		var zero V
+		return zero, err
+	}
+	return v, nil
+}
+
+// Set stores v as the value of key, like Group.Set.
+func (t *TypedGroup[V]) Set(ctx context.Context, key string, v V, expire time.Time) error {
+	b, err := t.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.g.Set(ctx, key, b, expire)
+}
+
+// Remove removes key, like Group.Remove.
+func (t *TypedGroup[V]) Remove(ctx context.Context, key string) error {
+	return t.g.Remove(ctx, key)
+}
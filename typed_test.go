@@ -0,0 +1,102 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+type typedUser struct {
+	Name string
+	Age  int
+}
+
+func testTypedGroup[V any](t *testing.T, codec Codec[V], load func(key string) V, equal func(a, b V) bool) {
+	t.Helper()
+	r := newTestRegistry(t)
+	var loads int
+	g, err := r.NewGroupWithOptions("g", TypedGetter(codec, func(_ context.Context, key string) (V, error) {
+		loads++
+		if key == "missing" {
+			var zero V
+			return zero, ErrNotFound
+		}
+		return load(key), nil
+	}), WithCacheBytes(1<<20), WithPeers(NoPeers{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed := Typed(g, codec)
+
+	for i := 0; i < 2; i++ {
+		v, err := typed.Get(context.TODO(), "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := load("k"); !equal(v, want) {
+			t.Errorf("Get = %v; want %v", v, want)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d; want 1", loads)
+	}
+	if _, err := typed.Get(context.TODO(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) err = %v; want ErrNotFound", err)
+	}
+
+	if err := typed.Set(context.TODO(), "set", load("other"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := typed.Get(context.TODO(), "set"); err != nil || !equal(v, load("other")) {
+		t.Errorf("Get after Set = %v, %v; want %v", v, err, load("other"))
+	}
+}
+
+func TestTypedGroupJSON(t *testing.T) {
+	t.Parallel()
+	testTypedGroup(t, JSONCodec[typedUser]{}, func(key string) typedUser {
+		return typedUser{Name: key, Age: len(key)}
+	}, func(a, b typedUser) bool { return a == b })
+}
+
+func TestTypedGroupGob(t *testing.T) {
+	t.Parallel()
+	testTypedGroup(t, GobCodec[map[string]int]{}, func(key string) map[string]int {
+		return map[string]int{key: len(key)}
+	}, func(a, b map[string]int) bool { return reflect.DeepEqual(a, b) })
+}
+
+func TestTypedGroupProto(t *testing.T) {
+	t.Parallel()
+	testTypedGroup(t, NewProtoCodec[pb.GetRequest](), func(key string) *pb.GetRequest {
+		return &pb.GetRequest{Group: proto.String("users"), Key: proto.String(key)}
+	}, func(a, b *pb.GetRequest) bool { return proto.Equal(a, b) })
+}
+
+func TestTypedGroupDecodeError(t *testing.T) {
+	t.Parallel()
+	r := newTestRegistry(t)
+	g := r.NewGroup("g", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "partial" {
+			// Name 能解出来 Age 的类型不对
+			return dest.SetString(`{"Name":"a","Age":"x"}`)
+		}
+		return dest.SetString("not json")
+	}), NoPeers{})
+	tg := Typed(g, JSONCodec[typedUser]{})
+	if _, err := tg.Get(context.TODO(), "k"); err == nil {
+		t.Error("Get decoded a value that is not JSON")
+	}
+	v, err := tg.Get(context.TODO(), "partial")
+	if err == nil {
+		t.Fatal("Get decoded a value of the wrong type")
+	}
+	if v != (typedUser{}) {
+		t.Errorf("Get with an error returned %+v; want the zero value", v)
+	}
+}
@@ -0,0 +1,204 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ProtoUpdater is optionally implemented by a ProtoGetter whose peer
+// accepts writes, needed by Group.Set and Group.Remove.
+type ProtoUpdater interface {
+	// Set stores the value in the peer's main cache.
+	Set(ctx context.Context, group, key string, value []byte, expire time.Time) error
+	// Remove drops the key from both of the peer's caches.
+	Remove(ctx context.Context, group, key string) error
+}
+
+// PeerLister is optionally implemented by a PeerPicker that can list
+// every peer but this process. Without it Set and Remove only reach the
+// key's owner, and stale copies in other peers' hotCache live on until
+// they are evicted.
+type PeerLister interface {
+	GetAll() []ProtoGetter
+}
+
+var errNoUpdate = errors.New("groupcache: peer does not accept updates")
+
+// Set stores value for key in the main cache of the key's owner, which
+// may be this process, and removes it from every other peer's hot cache.
+// A zero expire never expires.
+//
+// Groupcache values are normally immutable; Set is for callers that
+// write to the source of truth and need the cache to follow.
+func (g *Group) Set(ctx context.Context, key string, value []byte, expire time.Time) error {
+	g.peersOnce.Do(g.initPeers)
+
+	owner, remote := g.peers.PickPeer(key)
+	var err error
+	if remote {
+		err = updatePeer(owner, func(u ProtoUpdater) error {
+			return u.Set(ctx, g.name, key, value, expire)
+		})
+		g.removeLocally(key)
+	} else {
+		g.setLocally(key, ByteView{b: cloneBytes(value), e: expire})
+	}
+
+	return errors.Join(err, g.removeFromPeers(ctx, key, owner))
+}
+
+// Remove drops key from this process and every peer, so the next Get
+// loads it again. Loads already in flight do not put the old value back.
+func (g *Group) Remove(ctx context.Context, key string) error {
+	g.peersOnce.Do(g.initPeers)
+
+	g.removeLocally(key)
+	err := g.removeFromPeers(ctx, key, nil)
+
+	// 没法列出所有节点时 至少要通知拥有者
+	if _, ok := g.peers.(PeerLister); !ok {
+		if owner, ok := g.peers.PickPeer(key); ok {
+			err = updatePeer(owner, func(u ProtoUpdater) error {
+				return u.Remove(ctx, g.name, key)
+			})
+		}
+	}
+	return err
+}
+
+// removeFromPeers sends Remove to every peer except skip, concurrently.
+func (g *Group) removeFromPeers(ctx context.Context, key string, skip ProtoGetter) error {
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for _, peer := range lister.GetAll() {
+		if peer == skip {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := updatePeer(peer, func(u ProtoUpdater) error {
+				return u.Remove(ctx, g.name, key)
+			})
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func updatePeer(peer ProtoGetter, fn func(u ProtoUpdater) error) error {
+	u, ok := peer.(ProtoUpdater)
+	if !ok {
+		return errNoUpdate
+	}
+	return fn(u)
+}
+
+// setLocally is the peer side of Set.
+func (g *Group) setLocally(key string, value ByteView) {
+	ck := g.cacheKey(key)
+	value = g.compress(value)
+	g.inval.invalidate(key, func() {
+		g.hotCache.remove(ck)
+		g.missCache.remove(ck)
+		g.populateCache(ck, value, &g.mainCache)
+	})
+}
+
+// removeLocally is the peer side of Remove.
+func (g *Group) removeLocally(key string) {
+	// 旧的代已经访问不到了 只需要删除当前代
+	ck := g.cacheKey(key)
+	g.inval.invalidate(key, func() {
+		g.mainCache.remove(ck)
+		g.hotCache.remove(ck)
+		g.missCache.remove(ck)
+	})
+
+	// 之后的 Get 不再等待已经过时的加载
+	if f, ok := g.loadGroup.(interface{ Forget(key string) }); ok {
+		f.Forget(ck.flightKey())
+	}
+}
+
+// invalidations keeps loads that started before a Set or Remove of the
+// same key from writing their result into the cache.
+//
+// Every Set/Remove bumps seq. While loads are in flight the seq of the
+// last invalidation of each key is remembered; a load only populates the
+// cache if its key was not invalidated after the load began.
+type invalidations struct {
+	mu       sync.Mutex
+	seq      uint64
+	inflight int
+	keys     map[string]uint64
+}
+
+// begin marks the start of a load and returns its starting seq.
+func (iv *invalidations) begin() uint64 {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	iv.inflight++
+	return iv.seq
+}
+
+// end marks the end of a load started with begin.
+func (iv *invalidations) end() {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	iv.inflight--
+	// 没有进行中的加载时 之前的记录都没用了
+	if iv.inflight == 0 {
+		iv.keys = nil
+	}
+}
+
+// populate runs fn unless key was invalidated since start.
+func (iv *invalidations) populate(key string, start uint64, fn func()) {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	if iv.keys[key] > start {
+		return
+	}
+	fn()
+}
+
+// invalidated reports whether key was invalidated since start. It must be
+// called between begin and end.
+func (iv *invalidations) invalidated(key string, start uint64) bool {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	return iv.keys[key] > start
+}
+
+// invalidate bumps the seq for key and runs fn while no load can populate.
+func (iv *invalidations) invalidate(key string, fn func()) {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	iv.seq++
+	if iv.inflight > 0 {
+		if iv.keys == nil {
+			iv.keys = make(map[string]uint64)
+		}
+		iv.keys[key] = iv.seq
+	}
+	fn()
+}
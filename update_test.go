@@ -0,0 +1,163 @@
+package groupcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetAndRemoveLocal(t *testing.T) {
+	var loads atomic.Int32
+	g := newTestGroup("set-remove-local", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads.Add(1)
+		return dest.SetString("loaded")
+	}), NoPeers{})
+	ctx := context.TODO()
+
+	if err := g.Set(ctx, "k", []byte("set"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "set" {
+		t.Fatalf("Get after Set = %q, %v; want %q", s, err, "set")
+	}
+	if n := loads.Load(); n != 0 {
+		t.Fatalf("Get after Set loaded %d times", n)
+	}
+
+	if err := g.Remove(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "loaded" {
+		t.Fatalf("Get after Remove = %q, %v; want %q", s, err, "loaded")
+	}
+
+	// 过期之后重新加载
+	if err := g.Set(ctx, "e", []byte("short"), time.Now().Add(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Get(ctx, "e", StringSink(&s)); err != nil || s != "short" {
+		t.Fatalf("Get before expiry = %q, %v", s, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := g.Get(ctx, "e", StringSink(&s)); err != nil || s != "loaded" {
+		t.Fatalf("Get after expiry = %q, %v; want %q", s, err, "loaded")
+	}
+}
+
+func TestRemoveDuringLoad(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var calls atomic.Int32
+	g := newTestGroup("remove-during-load", GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+			return dest.SetString("old")
+		}
+		return dest.SetString("new")
+	}), NoPeers{})
+	ctx := context.TODO()
+
+	done := make(chan string)
+	go func() {
+		var s string
+		g.Get(ctx, "k", StringSink(&s))
+		done <- s
+	}()
+	<-started
+
+	if err := g.Remove(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不会等待 Remove 之前开始的加载
+	var s string
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "new" {
+		t.Fatalf("Get after Remove = %q, %v; want %q", s, err, "new")
+	}
+
+	close(release)
+	if got := <-done; got != "old" {
+		t.Errorf("in-flight Get = %q; want %q", got, "old")
+	}
+
+	// 旧的加载结果没有覆盖缓存
+	if err := g.Get(ctx, "k", StringSink(&s)); err != nil || s != "new" {
+		t.Errorf("cached value = %q, %v; want %q", s, err, "new")
+	}
+}
+
+func TestSetAndRemoveHTTPPeer(t *testing.T) {
+	const name = "set-remove-http"
+	reg := newTestRegistry(t)
+
+	owner := reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner-loaded")
+	}), NoPeers{})
+
+	ts := httptest.NewServer(newHTTPPool("", &HTTPPoolOptions{Registry: reg}))
+	defer ts.Close()
+	pool := newHTTPPool("http://self", nil)
+	pool.Set(ts.URL)
+
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), pool)
+	testSetAndRemovePeer(t, g, owner)
+}
+
+func TestSetAndRemoveGRPCPeer(t *testing.T) {
+	const name = "set-remove-grpc"
+	reg := newTestRegistry(t)
+
+	owner := reg.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("owner-loaded")
+	}), NoPeers{})
+
+	lis := startBufconnServer(t, newGRPCPool("owner", &GRPCPoolOptions{Registry: reg}))
+	pool := newGRPCPool("self", &GRPCPoolOptions{DialOptions: bufconnDialOptions(lis)})
+	defer pool.Close()
+	pool.Set("passthrough:///owner")
+
+	g := newTestGroup(name, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), pool)
+	testSetAndRemovePeer(t, g, owner)
+}
+
+func testSetAndRemovePeer(t *testing.T, g, owner *Group) {
+	t.Helper()
+	ctx := context.TODO()
+	expire := time.Now().Add(time.Hour)
+
+	if err := g.Set(ctx, "k", []byte("set"), expire); err != nil {
+		t.Fatal(err)
+	}
+	v, ok := owner.mainCache.get(owner.cacheKey("k"))
+	if !ok || v.String() != "set" {
+		t.Fatalf("owner mainCache = %q, %v; want %q", v.String(), ok, "set")
+	}
+	if !v.Expire().Equal(expire) {
+		t.Errorf("owner entry expires at %v; want %v", v.Expire(), expire)
+	}
+
+	// 模拟本地 hotCache 中的副本
+	g.populateCache(g.cacheKey("k"), ByteView{s: "hot"}, &g.hotCache)
+	owner.populateCache(owner.cacheKey("k"), ByteView{s: "hot"}, &owner.hotCache)
+
+	if err := g.Remove(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := owner.mainCache.get(owner.cacheKey("k")); ok {
+		t.Error("owner mainCache still has the removed key")
+	}
+	if _, ok := owner.hotCache.get(owner.cacheKey("k")); ok {
+		t.Error("owner hotCache still has the removed key")
+	}
+	if _, ok := g.hotCache.get(g.cacheKey("k")); ok {
+		t.Error("local hotCache still has the removed key")
+	}
+}